@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ConfigWatcher polls a mounted ConfigMap file for changes. Kubernetes updates
+// ConfigMap volumes by swapping the ..data symlink, so both the resolved path
+// and the modification time are compared.
+type ConfigWatcher struct {
+	path     string
+	interval time.Duration
+	onChange func(content string)
+
+	resolved string
+	modTime  time.Time
+	content  string
+}
+
+func NewConfigWatcher(path string, interval time.Duration, onChange func(content string)) *ConfigWatcher {
+	return &ConfigWatcher{path: path, interval: interval, onChange: onChange}
+}
+
+// Load reads the file once and returns its content.
+func (w *ConfigWatcher) Load() string {
+	w.resolved, w.modTime = w.fileVersion()
+	w.content = readFileContent(w.path)
+	return w.content
+}
+
+// Run polls the file until the process exits.
+func (w *ConfigWatcher) Run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		resolved, modTime := w.fileVersion()
+		if resolved == w.resolved && modTime.Equal(w.modTime) {
+			continue
+		}
+		w.resolved, w.modTime = resolved, modTime
+
+		content := readFileContent(w.path)
+		if content == w.content {
+			continue
+		}
+
+		fmt.Printf("Config file %s reloaded: %s\n", w.path, diffSummary(w.content, content))
+		w.content = content
+		w.onChange(content)
+	}
+}
+
+func (w *ConfigWatcher) fileVersion() (string, time.Time) {
+	resolved, err := filepath.EvalSymlinks(w.path)
+	if err != nil {
+		return "", time.Time{}
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return resolved, time.Time{}
+	}
+	return resolved, info.ModTime()
+}
+
+// diffSummary describes how many lines were added and removed between two
+// versions of a file, ignoring line order.
+func diffSummary(oldContent, newContent string) string {
+	counts := make(map[string]int)
+	for _, line := range splitLines(oldContent) {
+		counts[line]++
+	}
+
+	added := 0
+	for _, line := range splitLines(newContent) {
+		if counts[line] > 0 {
+			counts[line]--
+		} else {
+			added++
+		}
+	}
+
+	removed := 0
+	for _, n := range counts {
+		removed += n
+	}
+
+	return fmt.Sprintf("+%d -%d lines (%d -> %d bytes)", added, removed, len(oldContent), len(newContent))
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
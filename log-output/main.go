@@ -1,45 +1,67 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"sync"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 type AppState struct {
 	mu           sync.RWMutex
 	randomString string
+	instance     InstanceState
+	persisted    bool
 	lastUpdate   time.Time
-	pongCount    int
+	pong         PongCount
+	fileContent  string
+	message      string
 }
 
 var state AppState
 
 func main() {
-	// Load Helsinki timezone
-	loc, err := time.LoadLocation("Europe/Helsinki")
+	settings, err := loadSettings()
 	if err != nil {
-		fmt.Printf("Warning: Could not load Europe/Helsinki timezone, using UTC: %v\n", err)
-		loc = time.UTC
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
+	loc := settings.Location
 
-	// Generate a random string on startup
-	state.randomString = uuid.New().String()
+	// Reuse the random string from STATE_FILE if set, otherwise generate one
+	stateFile := os.Getenv("STATE_FILE")
+	instance, err := loadInstanceState(stateFile, time.Now().In(loc))
+	if err != nil {
+		log.Fatal(err)
+	}
+	state.instance = instance
+	state.persisted = stateFile != ""
+	state.randomString = instance.ID
 	state.lastUpdate = time.Now().In(loc)
 
 	fmt.Println("Log output application started")
 	fmt.Printf("Random string: %s\n", state.randomString)
+	if state.persisted {
+		fmt.Printf("State file: %s (first start %s, restart %d)\n",
+			stateFile, instance.FirstStart.Format(time.RFC3339), instance.RestartCount)
+	}
 	fmt.Printf("Timezone: %s\n", loc.String())
+	fmt.Printf("Tick interval: %s\n", settings.TickInterval)
+	fmt.Printf("Output format: %s\n", settings.OutputFormat)
 
-	// Read file content from ConfigMap
-	fileContent := readFileContent("/etc/config/information.txt")
+	// Read file content from ConfigMap and watch it for updates
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		configFile = "/etc/config/information.txt"
+	}
+	configWatcher := NewConfigWatcher(configFile, envDuration("CONFIG_POLL_INTERVAL", 10*time.Second), func(content string) {
+		state.mu.Lock()
+		state.fileContent = content
+		state.mu.Unlock()
+	})
+	fileContent := configWatcher.Load()
 
 	// Read environment variable from ConfigMap
 	envMessage := os.Getenv("MESSAGE")
@@ -47,24 +69,34 @@ func main() {
 	fmt.Printf("file content: %s\n", fileContent)
 	fmt.Printf("env variable: MESSAGE=%s\n", envMessage)
 
+	state.fileContent = fileContent
+	state.message = envMessage
+
+	pongClient, err := NewPongClientFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go configWatcher.Run()
+
 	// Start HTTP server in a goroutine
 	go startHTTPServer()
 
-	// Output the random string with timestamp every 5 seconds
-	ticker := time.NewTicker(5 * time.Second)
+	// Output the random string with timestamp every tick
+	ticker := time.NewTicker(settings.TickInterval)
 	defer ticker.Stop()
 
 	for range ticker.C {
 		// Fetch pong count from ping-pong service
-		pongCount := fetchPongCount()
+		pong := pongClient.Fetch(context.Background())
 
 		state.mu.Lock()
 		state.lastUpdate = time.Now().In(loc)
-		state.pongCount = pongCount
-		timestamp := state.lastUpdate.Format(time.RFC3339)
+		state.pong = pong
+		timestamp := state.lastUpdate
 		state.mu.Unlock()
 
-		fmt.Printf("%s: %s.\nPing / Pongs: %d\n", timestamp, state.randomString, pongCount)
+		fmt.Print(formatLogLine(settings.OutputFormat, timestamp, state.randomString, pong))
 	}
 }
 
@@ -77,33 +109,16 @@ func readFileContent(filepath string) string {
 	return string(content)
 }
 
-func fetchPongCount() int {
-	// Get the ping-pong service URL from environment or use default
-	pingPongURL := os.Getenv("PING_PONG_URL")
-	if pingPongURL == "" {
-		pingPongURL = "http://ping-pong-svc:2345/count"
-	}
-
-	resp, err := http.Get(pingPongURL)
-	if err != nil {
-		fmt.Printf("Error fetching pong count: %v\n", err)
-		return 0
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("Error reading response: %v\n", err)
-		return 0
+// formatPongCount renders the count for plain-text output, marking values
+// that could not be refreshed.
+func formatPongCount(pong PongCount, now time.Time) string {
+	if !pong.Known {
+		return "unknown (ping-pong unavailable)"
 	}
-
-	var result map[string]int
-	if err := json.Unmarshal(body, &result); err != nil {
-		fmt.Printf("Error parsing JSON: %v\n", err)
-		return 0
+	if pong.Stale {
+		return fmt.Sprintf("%d (stale for %s)", pong.Count, pong.StaleFor(now))
 	}
-
-	return result["count"]
+	return fmt.Sprintf("%d", pong.Count)
 }
 
 func startHTTPServer() {
@@ -113,138 +128,10 @@ func startHTTPServer() {
 	}
 
 	http.HandleFunc("/", handleStatus)
+	http.HandleFunc("/status", handleStatusJSON)
 
 	fmt.Printf("HTTP server started on port %s\n", port)
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatal(err)
 	}
 }
-
-func handleStatus(w http.ResponseWriter, r *http.Request) {
-	state.mu.RLock()
-	timestamp := state.lastUpdate.Format("2006-01-02 15:04:05 MST")
-	hash := state.randomString
-	pongCount := state.pongCount
-	state.mu.RUnlock()
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-	// Write HTML template with embedded values
-	fmt.Fprintf(w, `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Log Output - Exercise 2.1</title>
-    <style>
-        * {
-            margin: 0;
-            padding: 0;
-            box-sizing: border-box;
-        }
-        body {
-            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-            background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);
-            min-height: 100vh;
-            display: flex;
-            justify-content: center;
-            align-items: center;
-            padding: 20px;
-        }
-        .container {
-            background: white;
-            border-radius: 15px;
-            box-shadow: 0 20px 60px rgba(0, 0, 0, 0.3);
-            max-width: 600px;
-            width: 100%%;
-            padding: 40px;
-        }
-        h1 {
-            color: #667eea;
-            margin-bottom: 10px;
-            font-size: 2.5em;
-        }
-        .subtitle {
-            color: #666;
-            margin-bottom: 30px;
-            font-size: 1.1em;
-        }
-        .info-box {
-            background: #f8f9fa;
-            border-left: 4px solid #667eea;
-            padding: 15px;
-            margin-bottom: 20px;
-            border-radius: 5px;
-        }
-        .info-box h2 {
-            color: #333;
-            font-size: 1.2em;
-            margin-bottom: 10px;
-        }
-        .info-box p {
-            color: #666;
-            line-height: 1.6;
-            word-break: break-all;
-        }
-        .hash {
-            font-family: 'Courier New', monospace;
-            background: #e9ecef;
-            padding: 10px;
-            border-radius: 5px;
-            margin-top: 10px;
-            color: #495057;
-        }
-        .status {
-            display: flex;
-            align-items: center;
-            gap: 10px;
-            margin-top: 20px;
-        }
-        .status-indicator {
-            width: 12px;
-            height: 12px;
-            background: #10b981;
-            border-radius: 50%%;
-            animation: pulse 2s infinite;
-        }
-        @keyframes pulse {
-            0%%, 100%% {
-                opacity: 1;
-            }
-            50%% {
-                opacity: 0.5;
-            }
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>Log Output</h1>
-        <p class="subtitle">DevOps with Kubernetes - Exercise 2.1</p>
-
-        <div class="info-box">
-            <h2>Current Status</h2>
-            <p><strong>Timestamp:</strong></p>
-            <div class="hash">%s</div>
-        </div>
-
-        <div class="info-box">
-            <h2>Random String (UUID)</h2>
-            <p><strong>Hash:</strong></p>
-            <div class="hash">%s</div>
-        </div>
-
-        <div class="info-box">
-            <h2>Ping / Pongs</h2>
-            <p><strong>Count:</strong></p>
-            <div class="hash">%d</div>
-        </div>
-
-        <div class="status">
-            <div class="status-indicator"></div>
-            <span style="color: #10b981; font-weight: 600;">Application is running</span>
-        </div>
-    </div>
-</body>
-</html>`, timestamp, hash, pongCount)
-}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	pingpong "ping-pong/client"
+)
+
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// PongCount is the last known ping-pong count. Stale is set when the most
+// recent fetch failed and Count is the value from LastSuccess.
+type PongCount struct {
+	Count       int
+	Known       bool
+	Stale       bool
+	LastSuccess time.Time
+	LastError   string
+}
+
+// StaleFor returns how long the count has been stale, or zero when it is fresh.
+func (p PongCount) StaleFor(now time.Time) time.Duration {
+	if !p.Stale || p.LastSuccess.IsZero() {
+		return 0
+	}
+	return now.Sub(p.LastSuccess).Truncate(time.Second)
+}
+
+// PongClient fetches the ping-pong count with a per-attempt timeout, jittered
+// retries and a circuit breaker. On failure it keeps the last known value.
+type PongClient struct {
+	fetch   func(ctx context.Context) (int, error)
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	breaker *circuitBreaker
+
+	mu   sync.Mutex
+	last PongCount
+}
+
+// NewPongClientFromEnv builds a PongClient from the PING_PONG_* environment
+// variables. The gRPC client is used when PING_PONG_GRPC_ADDR is set.
+func NewPongClientFromEnv() (*PongClient, error) {
+	c := &PongClient{
+		timeout: envDuration("PING_PONG_TIMEOUT", 2*time.Second),
+		retries: envInt("PING_PONG_RETRIES", 2),
+		backoff: envDuration("PING_PONG_RETRY_BACKOFF", 200*time.Millisecond),
+		breaker: newCircuitBreaker(
+			envInt("PING_PONG_BREAKER_THRESHOLD", 3),
+			envDuration("PING_PONG_BREAKER_COOLDOWN", 30*time.Second),
+		),
+	}
+
+	if addr := os.Getenv("PING_PONG_GRPC_ADDR"); addr != "" {
+		grpcClient, err := pingpong.Dial(addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ping-pong gRPC client: %w", err)
+		}
+		c.fetch = func(ctx context.Context) (int, error) {
+			count, err := grpcClient.Get(ctx)
+			return int(count), err
+		}
+		fmt.Printf("Ping-pong gRPC address: %s\n", addr)
+		return c, nil
+	}
+
+	pingPongURL := os.Getenv("PING_PONG_URL")
+	if pingPongURL == "" {
+		pingPongURL = "http://ping-pong-svc:2345/count"
+	}
+	httpClient := &http.Client{}
+	c.fetch = func(ctx context.Context) (int, error) {
+		return fetchHTTPCount(ctx, httpClient, pingPongURL)
+	}
+	fmt.Printf("Ping-pong URL: %s\n", pingPongURL)
+	return c, nil
+}
+
+// Fetch tries to refresh the count and returns the latest known value.
+func (c *PongClient) Fetch(ctx context.Context) PongCount {
+	count, err := c.fetchWithRetry(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.last.Stale = true
+		c.last.LastError = err.Error()
+		return c.last
+	}
+
+	c.last = PongCount{Count: count, Known: true, LastSuccess: time.Now()}
+	return c.last
+}
+
+func (c *PongClient) fetchWithRetry(ctx context.Context) (int, error) {
+	var lastErr error
+
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			// Full jitter: sleep a random duration up to backoff * 2^(attempt-1)
+			delay := time.Duration(rand.Int63n(int64(c.backoff<<(attempt-1)) + 1))
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		if !c.breaker.Allow() {
+			return 0, errCircuitOpen
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		count, err := c.fetch(attemptCtx)
+		cancel()
+
+		if err == nil {
+			c.breaker.Success()
+			return count, nil
+		}
+
+		c.breaker.Failure()
+		lastErr = err
+		fmt.Printf("Error fetching pong count (attempt %d/%d): %v\n", attempt+1, c.retries+1, err)
+	}
+
+	return 0, lastErr
+}
+
+func fetchHTTPCount(ctx context.Context, client *http.Client, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Count *int `json:"count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	if result.Count == nil {
+		return 0, errors.New("response has no count field")
+	}
+
+	return *result.Count, nil
+}
+
+// circuitBreaker opens after threshold consecutive failures and lets a single
+// trial request through once cooldown has passed.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+
+	// Half-open: allow one trial request
+	b.trial = true
+	return true
+}
+
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures >= b.threshold {
+		fmt.Println("Ping-pong circuit breaker closed")
+	}
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.trial || b.failures == b.threshold {
+		b.openedAt = time.Now()
+		fmt.Printf("Ping-pong circuit breaker open for %s\n", b.cooldown)
+	}
+	b.trial = false
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: Invalid %s '%s', using %s", name, value, def)
+		return def
+	}
+	return d
+}
+
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Warning: Invalid %s '%s', using %d", name, value, def)
+		return def
+	}
+	return n
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cooledDown moves the breaker's opening back past its cooldown.
+func cooledDown(b *circuitBreaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.openedAt = time.Now().Add(-b.cooldown)
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	b := newCircuitBreaker(2, time.Hour)
+
+	// Closed: one failure is below the threshold
+	b.Failure()
+	if !b.Allow() {
+		t.Fatal("closed breaker rejects a request after one failure")
+	}
+
+	// Open: the second consecutive failure opens it until the cooldown
+	b.Failure()
+	for i := 0; i < 3; i++ {
+		if b.Allow() {
+			t.Fatal("open breaker allows a request")
+		}
+	}
+
+	// Half-open: one trial request after the cooldown, none alongside it
+	cooledDown(b)
+	if !b.Allow() {
+		t.Fatal("breaker does not allow a trial after the cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("half-open breaker allows a second request during the trial")
+	}
+
+	// A failed trial opens it for another cooldown
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("breaker allows a request right after a failed trial")
+	}
+
+	// A successful trial closes it, and the failures count from zero again
+	cooledDown(b)
+	if !b.Allow() {
+		t.Fatal("breaker does not allow a second trial")
+	}
+	b.Success()
+	b.Failure()
+	if !b.Allow() || !b.Allow() {
+		t.Error("closed breaker rejects requests after one new failure")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b := newCircuitBreaker(2, time.Hour)
+	b.Failure()
+	b.Success()
+	b.Failure()
+	if !b.Allow() {
+		t.Error("failures separated by a success opened the breaker")
+	}
+}
+
+// pongServer answers /count with a 503 for the first failures requests and
+// with the count after that.
+type pongServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	requests int
+}
+
+func newPongServer(t *testing.T, failures int) *pongServer {
+	s := &pongServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		if s.requests <= s.failures {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"count": %d}`, 40+s.requests)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *pongServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *pongServer) client(retries, threshold int) *PongClient {
+	return &PongClient{
+		fetch: func(ctx context.Context) (int, error) {
+			return fetchHTTPCount(ctx, s.Client(), s.URL)
+		},
+		timeout: time.Second,
+		retries: retries,
+		backoff: time.Millisecond,
+		breaker: newCircuitBreaker(threshold, time.Hour),
+	}
+}
+
+func TestPongClientRetriesUntilSuccess(t *testing.T) {
+	server := newPongServer(t, 2)
+	c := server.client(2, 5)
+
+	pong := c.Fetch(context.Background())
+	if !pong.Known || pong.Stale || pong.Count != 43 || pong.LastSuccess.IsZero() {
+		t.Errorf("pong = %+v, want the count from the third request", pong)
+	}
+	if server.count() != 3 {
+		t.Errorf("%d requests, want 3", server.count())
+	}
+}
+
+func TestPongClientUnknownWhenNeverReached(t *testing.T) {
+	server := newPongServer(t, 100)
+	c := server.client(1, 5)
+
+	pong := c.Fetch(context.Background())
+	if pong.Known || !pong.Stale || pong.LastError == "" {
+		t.Errorf("pong = %+v, want an unknown, stale count with the error", pong)
+	}
+	if pong.StaleFor(time.Now()) != 0 {
+		t.Errorf("never fetched count is stale for %s", pong.StaleFor(time.Now()))
+	}
+}
+
+func TestPongClientKeepsLastCountWhenDown(t *testing.T) {
+	server := newPongServer(t, 0)
+	c := server.client(2, 3)
+
+	first := c.Fetch(context.Background())
+	if !first.Known || first.Stale || first.Count != 41 {
+		t.Fatalf("pong = %+v, want a fresh count", first)
+	}
+
+	// Ping-pong goes down: three failed attempts open the breaker
+	server.mu.Lock()
+	server.failures = 100
+	server.mu.Unlock()
+	pong := c.Fetch(context.Background())
+	if !pong.Known || !pong.Stale || pong.Count != 41 || !pong.LastSuccess.Equal(first.LastSuccess) {
+		t.Errorf("pong = %+v, want the last count marked stale", pong)
+	}
+	if server.count() != 4 {
+		t.Errorf("%d requests, want 1 plus 3 attempts", server.count())
+	}
+
+	// While the breaker is open no request is made, nor retried
+	pong = c.Fetch(context.Background())
+	if server.count() != 4 {
+		t.Errorf("%d requests with the breaker open, want none", server.count()-4)
+	}
+	if !pong.Known || !pong.Stale || pong.Count != 41 || pong.LastError != errCircuitOpen.Error() {
+		t.Errorf("pong = %+v, want the last count with the breaker error", pong)
+	}
+
+	// Ping-pong is back: the trial request closes the breaker
+	server.mu.Lock()
+	server.failures = 0
+	server.mu.Unlock()
+	cooledDown(c.breaker)
+	pong = c.Fetch(context.Background())
+	if !pong.Known || pong.Stale || pong.Count != 45 || pong.LastError != "" {
+		t.Errorf("pong = %+v, want a fresh count", pong)
+	}
+}
+
+func TestPongClientStopsRetryingWhenBreakerOpens(t *testing.T) {
+	server := newPongServer(t, 100)
+	// Five attempts allowed, but the breaker opens after two failures
+	c := server.client(4, 2)
+
+	pong := c.Fetch(context.Background())
+	if pong.LastError != errCircuitOpen.Error() {
+		t.Errorf("pong = %+v, want the breaker error", pong)
+	}
+	if server.count() != 2 {
+		t.Errorf("%d requests, want 2", server.count())
+	}
+}
+
+func TestPongClientStopsWhenCancelled(t *testing.T) {
+	server := newPongServer(t, 100)
+	c := server.client(3, 10)
+	c.backoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.fetchWithRetry(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's error", err)
+	}
+	if server.count() != 1 {
+		t.Errorf("%d requests, want 1", server.count())
+	}
+}
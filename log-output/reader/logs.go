@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tailChunkSize      = 4096
+	followPollInterval = 250 * time.Millisecond
+	sseKeepalive       = 15 * time.Second
+	maxTailLines       = 10000
+)
+
+// handleLogs serves GET /logs?tail=N. Without tail the whole file is returned.
+// With several writer files their lines are merged by timestamp. Requests
+// with since, until or grep are searches across rotated segments.
+func handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if isSearchRequest(r) {
+		handleSearch(w, r)
+		return
+	}
+
+	tail, err := parseTail(r.URL.Query().Get("tail"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lines, err := readLogLines(logFiles(logFile), tail)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading log file: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// logFiles returns logFile and the per-writer files next to it, e.g.
+// output-<pod>.txt for output.txt with COORDINATION=per-writer, sorted by
+// name. If none exists, logFile is returned so reading it reports the error.
+func logFiles(logFile string) []string {
+	ext := filepath.Ext(logFile)
+	paths, _ := filepath.Glob(strings.TrimSuffix(logFile, ext) + "-*" + ext)
+	if _, err := os.Stat(logFile); err == nil || len(paths) == 0 {
+		paths = append([]string{logFile}, paths...)
+	}
+	return paths
+}
+
+// readLogLines returns the lines of the files merged by timestamp, or the
+// last tail of them if tail is positive.
+func readLogLines(paths []string, tail int) ([]string, error) {
+	files := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		var lines []string
+		var err error
+		if tail > 0 {
+			lines, err = tailLines(path, tail)
+		} else {
+			var data []byte
+			data, err = readFileRetry(path)
+			lines = splitLines(string(data))
+		}
+		if os.IsNotExist(err) && len(paths) > 1 {
+			// Rotated away since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, lines)
+	}
+
+	lines := mergeLines(files)
+	if tail > 0 && len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+	return lines, nil
+}
+
+// mergeLines merges the lines of several files, each in time order, by
+// their timestamps. A line without one stays right after the line before
+// it in its file.
+func mergeLines(files [][]string) []string {
+	if len(files) == 1 {
+		return files[0]
+	}
+
+	type head struct {
+		lines []string
+		key   time.Time
+	}
+	heads := make([]*head, 0, len(files))
+	total := 0
+	for _, lines := range files {
+		if len(lines) > 0 {
+			h := &head{lines: lines}
+			h.key, _ = parseLineTimestamp(lines[0])
+			heads = append(heads, h)
+			total += len(lines)
+		}
+	}
+
+	merged := make([]string, 0, total)
+	for len(heads) > 0 {
+		next := 0
+		for i, h := range heads {
+			if h.key.Before(heads[next].key) {
+				next = i
+			}
+		}
+
+		h := heads[next]
+		merged = append(merged, h.lines[0])
+		h.lines = h.lines[1:]
+		if len(h.lines) == 0 {
+			heads = append(heads[:next], heads[next+1:]...)
+		} else if ts, ok := parseLineTimestamp(h.lines[0]); ok {
+			h.key = ts
+		}
+	}
+	return merged
+}
+
+func parseTail(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxTailLines {
+		return 0, fmt.Errorf("tail must be an integer between 1 and %d", maxTailLines)
+	}
+	return n, nil
+}
+
+// tailLines returns the last n lines of path, reading backwards from the end
+// in fixed-size chunks so large files are not read in full.
+func tailLines(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	end := info.Size()
+	var buf []byte
+	for offset := end; offset > 0; {
+		size := int64(tailChunkSize)
+		if offset < size {
+			size = offset
+		}
+		offset -= size
+
+		chunk := make([]byte, size)
+		if _, err := file.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = append(chunk, buf...)
+
+		// One extra newline is needed when the file ends with a newline
+		if bytes.Count(buf, []byte("\n")) > n {
+			break
+		}
+	}
+
+	lines := splitLines(string(buf))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// handleFollow streams new lines as they are written, like tail -F. Clients
+// that accept text/event-stream get Server-Sent Events, others get chunked
+// plain text. ?tail=N sends the last N lines first. Writer files that
+// appear later are followed from their start.
+func handleFollow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	tail, err := parseTail(r.URL.Query().Get("tail"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	send := func(line string) error {
+		var err error
+		if sse {
+			_, err = fmt.Fprintf(w, "data: %s\n\n", line)
+		} else {
+			_, err = fmt.Fprintln(w, line)
+		}
+		flusher.Flush()
+		return err
+	}
+
+	paths := logFiles(logFile)
+	if tail > 0 {
+		lines, _ := readLogLines(paths, tail)
+		for _, line := range lines {
+			if err := send(line); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	followers := make(map[string]*follower)
+	for _, path := range paths {
+		followers[path] = newFollower(path)
+	}
+	defer func() {
+		for _, f := range followers {
+			f.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(followPollInterval)
+	defer ticker.Stop()
+	lastSend := time.Now()
+
+	log.Printf("GET /logs/follow - Client %s connected (sse=%t)", r.RemoteAddr, sse)
+	defer log.Printf("GET /logs/follow - Client %s disconnected", r.RemoteAddr)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		var polled [][]string
+		for _, path := range logFiles(logFile) {
+			f, ok := followers[path]
+			if !ok {
+				f = &follower{path: path}
+				followers[path] = f
+			}
+			polled = append(polled, f.Poll())
+		}
+
+		for _, line := range mergeLines(polled) {
+			if err := send(line); err != nil {
+				return
+			}
+			lastSend = time.Now()
+		}
+
+		if sse && time.Since(lastSend) >= sseKeepalive {
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			lastSend = time.Now()
+		}
+	}
+}
+
+// follower tracks a file by name. It reopens the file when it is replaced
+// (rotation or atomic rename) and starts over when it is truncated.
+type follower struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial string
+
+	// seenModTime is the modification time of the file when everything up to
+	// offset had been read. A newer time at the same size means the content
+	// was rewritten in place.
+	seenModTime time.Time
+}
+
+// newFollower starts following path from its current end.
+func newFollower(path string) *follower {
+	f := &follower{path: path}
+	if f.reopen() {
+		f.offset = f.info.Size()
+		f.seenModTime = f.info.ModTime()
+	}
+	return f
+}
+
+func (f *follower) reopen() bool {
+	f.Close()
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return false
+	}
+
+	f.file, f.info, f.offset, f.partial = file, info, 0, ""
+	f.seenModTime = time.Time{}
+	return true
+}
+
+// Poll returns the complete lines written since the last call.
+func (f *follower) Poll() []string {
+	if f.file == nil && !f.reopen() {
+		return nil
+	}
+
+	var lines []string
+
+	current, err := os.Stat(f.path)
+	switch {
+	case err != nil:
+		// The file is missing between rotation steps; keep reading the old one
+	case !os.SameFile(f.info, current):
+		// Rotated or replaced: finish the old file, then read the new one from the start
+		lines = append(lines, f.readNew()...)
+		if f.partial != "" {
+			lines = append(lines, f.partial)
+		}
+		if !f.reopen() {
+			return lines
+		}
+	case current.Size() < f.offset,
+		current.Size() == f.offset && current.ModTime().After(f.seenModTime):
+		// Truncated, or rewritten with the same length. Some filesystems reuse
+		// the inode of a file replaced by rename, so SameFile cannot tell.
+		if !f.reopen() {
+			return nil
+		}
+	}
+
+	return append(lines, f.readNew()...)
+}
+
+func (f *follower) readNew() []string {
+	if _, err := f.file.Seek(f.offset, io.SeekStart); err != nil {
+		return nil
+	}
+
+	var lines []string
+	reader := bufio.NewReader(f.file)
+	for {
+		chunk, err := reader.ReadString('\n')
+		f.offset += int64(len(chunk))
+		if err != nil {
+			// Keep an incomplete last line until its newline arrives
+			f.partial += chunk
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(f.partial+chunk, "\n"))
+		f.partial = ""
+	}
+
+	if info, err := f.file.Stat(); err == nil && info.Size() == f.offset {
+		f.seenModTime = info.ModTime()
+	}
+	return lines
+}
+
+func (f *follower) Close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeWriterFiles writes per-writer files the way COORDINATION=per-writer
+// does, and returns the shared log file path they belong to.
+func writeWriterFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "output.txt")
+}
+
+func TestPerWriterFilesAreMerged(t *testing.T) {
+	path := writeWriterFiles(t, map[string]string{
+		"output-a.txt":   "2025-12-01T12:00:00Z: one [a]\n2025-12-01T12:00:10Z: three [a]\n",
+		"output-b.txt":   "2025-12-01T12:00:05Z: two [b]\nno timestamp [b]\n2025-12-01T12:00:15Z: four [b]\n",
+		"output-b.txt.1": "2025-12-01T11:59:55Z: rotated [b]\n",
+		"other.txt":      "2025-12-01T12:00:07Z: not a writer file\n",
+	})
+
+	// Rotated before the current file was last written
+	rotated := filepath.Join(filepath.Dir(path), "output-b.txt.1")
+	if err := os.Chtimes(rotated, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := logFiles(path)
+	if want := []string{filepath.Join(filepath.Dir(path), "output-a.txt"), filepath.Join(filepath.Dir(path), "output-b.txt")}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("logFiles = %q, want %q", paths, want)
+	}
+
+	lines, err := readLogLines(paths, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"2025-12-01T12:00:00Z: one [a]",
+		"2025-12-01T12:00:05Z: two [b]",
+		"no timestamp [b]",
+		"2025-12-01T12:00:10Z: three [a]",
+		"2025-12-01T12:00:15Z: four [b]",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("merged lines:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+
+	lines, err = readLogLines(paths, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lines, want[3:]) {
+		t.Errorf("tail 2 = %q, want %q", lines, want[3:])
+	}
+
+	// Searches include the rotated segment and keep the merged order
+	var matches []string
+	err = searchLogs(paths, LogQuery{Grep: regexp.MustCompile(`\[b\]`)}, func(m LogMatch) error {
+		matches = append(matches, m.Source+" "+m.Line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMatches := []string{
+		"output-b.txt.1 2025-12-01T11:59:55Z: rotated [b]",
+		"output-b.txt 2025-12-01T12:00:05Z: two [b]",
+		"output-b.txt no timestamp [b]",
+		"output-b.txt 2025-12-01T12:00:15Z: four [b]",
+	}
+	if !reflect.DeepEqual(matches, wantMatches) {
+		t.Errorf("search matches:\n%s\nwant:\n%s", strings.Join(matches, "\n"), strings.Join(wantMatches, "\n"))
+	}
+
+	matches = nil
+	since, _ := time.Parse(time.RFC3339, "2025-12-01T12:00:05Z")
+	err = searchLogs(paths, LogQuery{Since: since, Tail: 2}, func(m LogMatch) error {
+		matches = append(matches, m.Line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(matches, []string{want[3], want[4]}) {
+		t.Errorf("since with tail 2 = %q, want %q", matches, []string{want[3], want[4]})
+	}
+}
+
+func TestLogSourceReadsEveryWriter(t *testing.T) {
+	oldLogFile, oldCounterFile := logFile, counterFile
+	t.Cleanup(func() { logFile, counterFile = oldLogFile, oldCounterFile })
+	logFile = writeWriterFiles(t, map[string]string{
+		"output-a.txt": "2025-12-01T12:00:00Z: one [a]\n",
+		"output-b.txt": "2025-12-01T12:00:05Z: two [b]\n",
+	})
+	counterFile = filepath.Join(filepath.Dir(logFile), "pingpong.txt")
+	sources, err := loadSources("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := sources[0].readValue(context.Background())
+	if want := "2025-12-01T12:00:00Z: one [a]\n2025-12-01T12:00:05Z: two [b]"; value.Value != want || value.Error != "" {
+		t.Errorf("log source = %q (error %q), want %q", value.Value, value.Error, want)
+	}
+}
+
+func TestSharedLogFileIsStillRead(t *testing.T) {
+	path := writeWriterFiles(t, map[string]string{"output.txt": "2025-12-01T12:00:00Z: one [a]\n"})
+	if paths := logFiles(path); !reflect.DeepEqual(paths, []string{path}) {
+		t.Errorf("logFiles = %q, want only %s", paths, path)
+	}
+
+	missing := filepath.Join(t.TempDir(), "output.txt")
+	if _, err := readLogLines(logFiles(missing), 0); !os.IsNotExist(err) {
+		t.Errorf("without any log file: err = %v, want not exist", err)
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	// Lines of varying length over several chunks
+	var b strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&b, "line %d %s\n", i, strings.Repeat("x", i%97))
+	}
+	long := b.String()
+
+	// The last chunk holds exactly 64 lines of 64 bytes, so the newline
+	// before them is the last byte of the chunk before
+	aligned := "first\n" + strings.Repeat(strings.Repeat("y", 63)+"\n", tailChunkSize/64)
+
+	for _, tt := range []struct {
+		name    string
+		content string
+		counts  []int
+	}{
+		{"empty", "", []int{1, 10}},
+		{"short", "a\nb\nc\n", []int{1, 2, 3, 4, 100}},
+		{"no trailing newline", "a\nb\nc", []int{1, 2, 3, 4}},
+		{"blank lines", "a\n\n\nb\n", []int{1, 2, 3, 4}},
+		{"chunks", long, []int{1, 40, 41, 100, 999, 1000, 5000}},
+		{"chunks without trailing newline", strings.TrimSuffix(long, "\n"), []int{1, 100, 1000, 5000}},
+		{"aligned", aligned, []int{1, 63, 64, 65, 66}},
+		{"line longer than a chunk", "a\n" + strings.Repeat("z", 3*tailChunkSize) + "\n", []int{1, 2, 3}},
+	} {
+		path := filepath.Join(t.TempDir(), "output.txt")
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		all := splitLines(tt.content)
+		for _, n := range tt.counts {
+			want := all
+			if len(want) > n {
+				want = want[len(want)-n:]
+			}
+			got, err := tailLines(path, n)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: last %d lines = %d lines starting %.20q, want %d starting %.20q", tt.name, n, len(got), got, len(want), want)
+			}
+		}
+	}
+
+	if _, err := tailLines(filepath.Join(t.TempDir(), "missing.txt"), 1); !os.IsNotExist(err) {
+		t.Errorf("missing file: err = %v, want not exist", err)
+	}
+}
+
+func appendFile(t *testing.T, path, content string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkPoll(t *testing.T, f *follower, want ...string) {
+	t.Helper()
+	if got := f.Poll(); !reflect.DeepEqual(got, want) && len(got)+len(want) > 0 {
+		t.Errorf("Poll() = %q, want %q", got, want)
+	}
+}
+
+func TestFollowerReadsNewLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	appendFile(t, path, "old\n")
+	f := newFollower(path)
+	defer f.Close()
+
+	// Starts from the end, and keeps a partial line until its newline
+	checkPoll(t, f)
+	appendFile(t, path, "one\ntw")
+	checkPoll(t, f, "one")
+	appendFile(t, path, "o\nthree\n")
+	checkPoll(t, f, "two", "three")
+	checkPoll(t, f)
+}
+
+func TestFollowerRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	appendFile(t, path, "old\n")
+	f := newFollower(path)
+	defer f.Close()
+
+	// Lines written just before the rename, including an unfinished one, are
+	// still read from the rotated file before the new one
+	appendFile(t, path, "before\nunfinished")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "after\n")
+	checkPoll(t, f, "before", "unfinished", "after")
+
+	appendFile(t, path+".1", "late\n")
+	appendFile(t, path, "next\n")
+	checkPoll(t, f, "next")
+}
+
+func TestFollowerMissingBetweenRotationSteps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	appendFile(t, path, "old\n")
+	f := newFollower(path)
+	defer f.Close()
+
+	appendFile(t, path, "before\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	checkPoll(t, f, "before")
+	checkPoll(t, f)
+
+	appendFile(t, path, "after\n")
+	checkPoll(t, f, "after")
+}
+
+func TestFollowerTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	appendFile(t, path, "one\ntwo\n")
+	f := newFollower(path)
+	defer f.Close()
+	checkPoll(t, f)
+
+	// Truncated and rewritten shorter: start over from the beginning
+	if err := os.WriteFile(path, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkPoll(t, f, "new")
+
+	// Truncated to nothing, then written again
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	checkPoll(t, f)
+	appendFile(t, path, "again\n")
+	checkPoll(t, f, "again")
+}
+
+func TestFollowerRewriteWithSameLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	appendFile(t, path, "aaa\n")
+	f := newFollower(path)
+	defer f.Close()
+	checkPoll(t, f)
+
+	// Rewritten in place with the same number of bytes, only the
+	// modification time tells
+	if err := os.WriteFile(path, []byte("bbb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	checkPoll(t, f, "bbb")
+	checkPoll(t, f)
+}
+
+func TestFollowerFileCreatedLater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output-c.txt")
+	// A writer file that appears later is followed from its start
+	f := &follower{path: path}
+	defer f.Close()
+	checkPoll(t, f)
+
+	appendFile(t, path, "first\n")
+	checkPoll(t, f, "first")
+
+	if f.reopen(); f.offset != 0 || f.partial != "" || !f.seenModTime.IsZero() {
+		t.Errorf("reopen kept offset %d, partial %q", f.offset, f.partial)
+	}
+	os.Remove(path)
+	if f.reopen() || f.file != nil {
+		t.Error("reopen of a missing file succeeded")
+	}
+}
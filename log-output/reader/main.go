@@ -5,7 +5,19 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
+)
+
+// emptyReadRetryDelay is how long to wait before re-reading an empty file.
+const emptyReadRetryDelay = 50 * time.Millisecond
+
+var (
+	logFile      string
+	counterFile  string
+	heartbeatDir string
+	sources      []Source
 )
 
 func main() {
@@ -14,33 +26,93 @@ func main() {
 		port = "3000"
 	}
 
+	logFile = os.Getenv("LOG_FILE")
+	if logFile == "" {
+		logFile = "/usr/src/app/files/output.txt"
+	}
+
+	counterFile = os.Getenv("COUNTER_FILE")
+	if counterFile == "" {
+		counterFile = "/usr/src/app/files/pingpong.txt"
+	}
+
+	heartbeatDir = os.Getenv("HEARTBEAT_DIR")
+	if heartbeatDir == "" {
+		heartbeatDir = filepath.Join(filepath.Dir(logFile), "writers")
+	}
+
+	if value := os.Getenv("WRITER_STALE_AFTER"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid WRITER_STALE_AFTER %q: must be a positive duration", value)
+		}
+		staleAfter = d
+	}
+
+	if value := os.Getenv("WRITER_RETENTION"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid WRITER_RETENTION %q: must be a positive duration", value)
+		}
+		writerRetention = d
+	}
+
+	var err error
+	sources, err = loadSources(os.Getenv("SOURCES_CONFIG"))
+	if err != nil {
+		log.Fatalf("Failed to load sources: %v", err)
+	}
+
 	http.HandleFunc("/", handleStatus)
+	http.HandleFunc("/logs", handleLogs)
+	http.HandleFunc("/logs/follow", handleFollow)
+	http.HandleFunc("/sources", handleSources)
+	http.HandleFunc("/sources/", handleSources)
+	http.HandleFunc("/writers", handleWriters)
 
 	fmt.Printf("Log reader HTTP server started on port %s\n", port)
+	fmt.Printf("Log files: %s\n", strings.Join(logFiles(logFile), ", "))
+	for _, source := range sources {
+		fmt.Printf("Source %s: %s\n", source.Name, source.Type)
+	}
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// handleStatus combines all sources in order, one per line. Sources with a
+// label are prefixed with it, e.g. "Ping / Pongs: 3".
 func handleStatus(w http.ResponseWriter, r *http.Request) {
-	// Read log output
-	logData, err := os.ReadFile("/usr/src/app/files/output.txt")
-	if err != nil {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		fmt.Fprintf(w, "Error reading log file: %v", err)
-		return
-	}
+	lines := make([]string, 0, len(sources))
+	for i := range sources {
+		source := &sources[i]
+		value := source.readValue(r.Context())
 
-	// Read ping-pong counter
-	counterData, err := os.ReadFile("/usr/src/app/files/pingpong.txt")
-	counter := "0"
-	if err == nil {
-		counter = strings.TrimSpace(string(counterData))
+		if value.Error != "" && source.Default == "" {
+			lines = append(lines, fmt.Sprintf("Error reading %s: %s", source.Name, value.Error))
+			continue
+		}
+		if source.Label != "" {
+			lines = append(lines, source.Label+": "+value.Value)
+		} else {
+			lines = append(lines, value.Value)
+		}
 	}
 
-	// Combine output
-	output := strings.TrimSpace(string(logData)) + "\nPing / Pongs: " + counter
+	lines = append(lines, writerStatusLines(readWriterStatuses(heartbeatDir, time.Now()))...)
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	fmt.Fprint(w, output)
+	fmt.Fprint(w, strings.Join(lines, "\n"))
+}
+
+// readFileRetry reads path and retries once if it is empty, which can happen
+// when a writer that does not replace the file atomically is mid-write.
+func readFileRetry(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) > 0 {
+		return data, err
+	}
+
+	time.Sleep(emptyReadRetryDelay)
+	return os.ReadFile(path)
 }
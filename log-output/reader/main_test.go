@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replaceFile replaces path the way the log writer does: a temp file in the
+// same directory renamed over it.
+func replaceFile(path, content string) error {
+	tmp := filepath.Join(filepath.Dir(path), ".output.txt.tmp")
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func TestReadFileRetryWithConcurrentWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	line := func(n int) string {
+		return fmt.Sprintf("2025-12-01T12:00:00Z: %d %s\n", n, strings.Repeat("x", n%53*31))
+	}
+	if err := replaceFile(path, line(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 1; ; n++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := replaceFile(path, line(n)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(300 * time.Millisecond)
+	reads := 0
+	for time.Now().Before(deadline) {
+		data, err := readFileRetry(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		if _, err := fmt.Sscanf(string(data), "2025-12-01T12:00:00Z: %d", &n); err != nil || string(data) != line(n) {
+			t.Fatalf("read a torn or empty file after %d reads: %q", reads, data)
+		}
+		reads++
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestReadFileRetryWaitsForEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An older writer truncated the file and writes the line shortly after
+	go func() {
+		time.Sleep(emptyReadRetryDelay / 5)
+		os.WriteFile(path, []byte("line\n"), 0644)
+	}()
+
+	data, err := readFileRetry(path)
+	if err != nil || string(data) != "line\n" {
+		t.Errorf("readFileRetry = %q, %v, want the line written during the retry delay", data, err)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogQuery filters log lines by time range and pattern. Zero values match
+// everything.
+type LogQuery struct {
+	Since time.Time
+	Until time.Time
+	Grep  *regexp.Regexp
+	Tail  int
+}
+
+func (q LogQuery) hasTimeRange() bool {
+	return !q.Since.IsZero() || !q.Until.IsZero()
+}
+
+// LogMatch is one line returned by a search.
+type LogMatch struct {
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Line      string     `json:"line"`
+	Source    string     `json:"source"`
+}
+
+func isSearchRequest(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Has("since") || q.Has("until") || q.Has("grep")
+}
+
+func parseLogQuery(r *http.Request, now time.Time) (LogQuery, error) {
+	var query LogQuery
+	var err error
+	values := r.URL.Query()
+
+	if query.Since, err = parseTimeParam(values.Get("since"), now); err != nil {
+		return query, fmt.Errorf("since: %w", err)
+	}
+	if query.Until, err = parseTimeParam(values.Get("until"), now); err != nil {
+		return query, fmt.Errorf("until: %w", err)
+	}
+	if pattern := values.Get("grep"); pattern != "" {
+		if query.Grep, err = regexp.Compile(pattern); err != nil {
+			return query, fmt.Errorf("grep: %w", err)
+		}
+	}
+	if query.Tail, err = parseTail(values.Get("tail")); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// parseTimeParam accepts an RFC3339 timestamp or a duration such as 15m,
+// which is taken relative to now.
+func parseTimeParam(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither an RFC3339 timestamp nor a duration", value)
+}
+
+// handleSearch serves GET /logs?since=&until=&grep=. Results are plain text
+// by default, or JSON lines with ?format=jsonl or Accept: application/x-ndjson.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	query, err := parseLogQuery(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jsonLines := r.URL.Query().Get("format") == "jsonl" ||
+		strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+
+	if jsonLines {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	encoder := json.NewEncoder(bw)
+
+	emit := func(m LogMatch) error {
+		if jsonLines {
+			return encoder.Encode(m)
+		}
+		_, err := fmt.Fprintln(bw, m.Line)
+		return err
+	}
+
+	if err := searchLogs(logFiles(logFile), query, emit); err != nil {
+		// Headers are already sent, so the error can only be logged
+		fmt.Printf("Error searching logs: %v\n", err)
+	}
+}
+
+// searchLogs scans each file and its rotated segments, oldest first,
+// streaming matching lines to emit. The matches of several files are merged
+// by timestamp. With Tail set only the last Tail matches are kept, in a ring
+// buffer.
+func searchLogs(paths []string, query LogQuery, emit func(LogMatch) error) error {
+	var files []*fileMatches
+	for _, path := range paths {
+		segments, err := logSegments(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, &fileMatches{query: query, segments: segments})
+	}
+	defer func() {
+		for _, f := range files {
+			f.close()
+		}
+	}()
+
+	var ring []LogMatch
+	next := 0
+	collect := emit
+	if query.Tail > 0 {
+		ring = make([]LogMatch, 0, query.Tail)
+		collect = func(m LogMatch) error {
+			if len(ring) < query.Tail {
+				ring = append(ring, m)
+			} else {
+				ring[next] = m
+				next = (next + 1) % query.Tail
+			}
+			return nil
+		}
+	}
+
+	// The next match of each file
+	type head struct {
+		file  *fileMatches
+		match LogMatch
+		key   time.Time
+	}
+	var heads []*head
+	advance := func(h *head) (bool, error) {
+		match, ok, err := h.file.next()
+		if ok {
+			h.match, h.key = match, h.file.last
+		}
+		return ok, err
+	}
+	for _, f := range files {
+		h := &head{file: f}
+		ok, err := advance(h)
+		if err != nil {
+			return err
+		}
+		if ok {
+			heads = append(heads, h)
+		}
+	}
+
+	for len(heads) > 0 {
+		next := 0
+		for i, h := range heads {
+			if h.key.Before(heads[next].key) {
+				next = i
+			}
+		}
+
+		h := heads[next]
+		if err := collect(h.match); err != nil {
+			return err
+		}
+		ok, err := advance(h)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			heads = append(heads[:next], heads[next+1:]...)
+		}
+	}
+
+	for i := 0; i < len(ring); i++ {
+		if err := emit(ring[(next+i)%len(ring)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type logSegment struct {
+	path    string
+	modTime time.Time
+}
+
+// logSegments returns path and its rotated segments (path.1, path.2.gz,
+// path.20251201T120005.123456789Z, ...) ordered from oldest to newest.
+func logSegments(path string) ([]logSegment, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	matches = append(matches, path)
+
+	var segments []logSegment
+	for _, match := range matches {
+		if strings.HasSuffix(match, ".lock") {
+			continue
+		}
+		info, err := os.Stat(match)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		segments = append(segments, logSegment{path: match, modTime: info.ModTime()})
+	}
+
+	// Segments rotated within the filesystem's timestamp granularity share a
+	// modification time, so their names decide
+	sort.SliceStable(segments, func(i, j int) bool {
+		a, b := segments[i], segments[j]
+		if !a.modTime.Equal(b.modTime) {
+			return a.modTime.Before(b.modTime)
+		}
+		return olderSegmentName(path, a.path, b.path)
+	})
+	return segments, nil
+}
+
+// segmentNameTimeFormat parses the writer's timestamped segment names, with
+// or without fractional seconds.
+const segmentNameTimeFormat = "20060102T150405Z"
+
+// olderSegmentName reports whether segment a of path was rotated before b
+// going by their names: path itself is the newest, path.2 is older than
+// path.1, and timestamped segments are ordered by their timestamp and then
+// by the -N suffix added to names taken within the same tick.
+func olderSegmentName(path, a, b string) bool {
+	if a == path || b == path {
+		return b == path && a != path
+	}
+	aNumber, aStamp, aSeq, aOK := parseSegmentName(path, a)
+	bNumber, bStamp, bSeq, bOK := parseSegmentName(path, b)
+	switch {
+	case !aOK || !bOK || (aNumber > 0) != (bNumber > 0):
+		return a < b
+	case aNumber > 0:
+		return aNumber > bNumber
+	case !aStamp.Equal(bStamp):
+		return aStamp.Before(bStamp)
+	default:
+		return aSeq < bSeq
+	}
+}
+
+// parseSegmentName returns the number of a numbered segment of path, or the
+// timestamp and -N suffix of a timestamped one.
+func parseSegmentName(path, segment string) (number int, stamp time.Time, seq int, ok bool) {
+	suffix := strings.TrimSuffix(strings.TrimPrefix(segment, path+"."), ".gz")
+	if n, err := strconv.Atoi(suffix); err == nil && n > 0 {
+		return n, time.Time{}, 0, true
+	}
+	if i := strings.LastIndex(suffix, "Z-"); i >= 0 {
+		n, err := strconv.Atoi(suffix[i+2:])
+		if err != nil {
+			return 0, time.Time{}, 0, false
+		}
+		suffix, seq = suffix[:i+1], n
+	}
+	stamp, err := time.Parse(segmentNameTimeFormat, suffix)
+	if err != nil {
+		return 0, time.Time{}, 0, false
+	}
+	return 0, stamp, seq, true
+}
+
+// fileMatches reads the matching lines of one log file's segments in order.
+type fileMatches struct {
+	query    LogQuery
+	segments []logSegment
+
+	file    *os.File
+	scanner *bufio.Scanner
+	source  string
+
+	// last is the timestamp of the last line read, which lines without one
+	// are ordered by
+	last time.Time
+}
+
+// next returns the next matching line, or false after the last segment.
+func (f *fileMatches) next() (LogMatch, bool, error) {
+	for {
+		if f.scanner == nil {
+			if len(f.segments) == 0 {
+				return LogMatch{}, false, nil
+			}
+			segment := f.segments[0]
+			f.segments = f.segments[1:]
+
+			// Every line in a segment is older than its last modification
+			if !f.query.Since.IsZero() && segment.modTime.Before(f.query.Since) {
+				continue
+			}
+			if err := f.open(segment.path); err != nil {
+				return LogMatch{}, false, err
+			}
+			continue
+		}
+
+		if !f.scanner.Scan() {
+			err := f.scanner.Err()
+			f.close()
+			if err != nil {
+				return LogMatch{}, false, err
+			}
+			continue
+		}
+		line := f.scanner.Text()
+
+		ts, ok := parseLineTimestamp(line)
+		if ok {
+			f.last = ts
+		}
+		if f.query.hasTimeRange() {
+			if !ok {
+				continue
+			}
+			if !f.query.Since.IsZero() && ts.Before(f.query.Since) {
+				continue
+			}
+			if !f.query.Until.IsZero() && ts.After(f.query.Until) {
+				continue
+			}
+		}
+		if f.query.Grep != nil && !f.query.Grep.MatchString(line) {
+			continue
+		}
+
+		match := LogMatch{Line: line, Source: f.source}
+		if ok {
+			match.Timestamp = &ts
+		}
+		return match, true, nil
+	}
+}
+
+// open starts reading the segment at path. A segment rotated away since it
+// was listed is skipped.
+func (f *fileMatches) open(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		// Closing the file is enough; gzip.Reader holds no other resources
+		reader = zr
+	}
+
+	f.file = file
+	f.scanner = bufio.NewScanner(reader)
+	f.source = filepath.Base(path)
+	return nil
+}
+
+func (f *fileMatches) close() {
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file, f.scanner = nil, nil
+}
+
+// parseLineTimestamp extracts the timestamp from a line in any of the log
+// writer's output formats: "<RFC3339>: ...", JSON with a "timestamp" field
+// or logfmt with timestamp=<RFC3339>.
+func parseLineTimestamp(line string) (time.Time, bool) {
+	var raw string
+	switch {
+	case strings.HasPrefix(line, "{"):
+		var entry struct {
+			Timestamp string `json:"timestamp"`
+		}
+		if json.Unmarshal([]byte(line), &entry) != nil {
+			return time.Time{}, false
+		}
+		raw = entry.Timestamp
+	case strings.HasPrefix(line, "timestamp="):
+		raw, _, _ = strings.Cut(strings.TrimPrefix(line, "timestamp="), " ")
+	default:
+		// RFC3339 contains colons itself, so cut at the first ": "
+		raw, _, _ = strings.Cut(line, ": ")
+	}
+
+	ts, err := time.Parse(time.RFC3339, raw)
+	return ts, err == nil
+}
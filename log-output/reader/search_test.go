@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeSegments creates the segments of path, all modified at the same time,
+// in the order given.
+func writeSegments(t *testing.T, path string, suffixes ...string) {
+	t.Helper()
+	modTime := time.Date(2025, 12, 1, 12, 0, 5, 0, time.UTC)
+	for _, suffix := range suffixes {
+		if err := os.WriteFile(path+suffix, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path+suffix, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func segmentNames(t *testing.T, path string) []string {
+	t.Helper()
+	segments, err := logSegments(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, segment := range segments {
+		names = append(names, filepath.Base(segment.path))
+	}
+	return names
+}
+
+func TestLogSegmentsWithEqualModTimes(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		suffixes []string
+		want     []string
+	}{
+		{
+			"numbered",
+			[]string{"", ".1", ".10", ".2.gz", ".3", ".lock"},
+			[]string{"output.txt.10", "output.txt.3", "output.txt.2.gz", "output.txt.1", "output.txt"},
+		},
+		{
+			"timestamped",
+			[]string{
+				"",
+				".20251201T120005.000000001Z",
+				".20251201T120005.000000000Z-2.gz",
+				".20251201T120004Z",
+				".20251201T120005.000000000Z",
+				".20251201T120005.000000000Z-1",
+			},
+			[]string{
+				"output.txt.20251201T120004Z",
+				"output.txt.20251201T120005.000000000Z",
+				"output.txt.20251201T120005.000000000Z-1",
+				"output.txt.20251201T120005.000000000Z-2.gz",
+				"output.txt.20251201T120005.000000001Z",
+				"output.txt",
+			},
+		},
+	} {
+		path := filepath.Join(t.TempDir(), "output.txt")
+		writeSegments(t, path, tt.suffixes...)
+		if got := segmentNames(t, path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: segments = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLogSegmentsByModTime(t *testing.T) {
+	// A newer modification time wins over the name
+	path := filepath.Join(t.TempDir(), "output.txt")
+	writeSegments(t, path, "", ".1", ".2")
+	later := time.Date(2025, 12, 1, 12, 0, 6, 0, time.UTC)
+	if err := os.Chtimes(path+".2", later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := segmentNames(t, path), []string{"output.txt.1", "output.txt", "output.txt.2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("segments = %q, want %q", got, want)
+	}
+}
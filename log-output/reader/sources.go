@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultSourceTimeout = 2 * time.Second
+
+// Source is a named value shown by the reader. Type selects where the value
+// comes from:
+//
+//	file - contents of Path, or of every file matching it if it is a glob
+//	http - Field of the JSON object returned by URL (dots for nested fields)
+//	env  - value of the environment variable Env
+//
+// Label prefixes the value in the combined status view, and Default is used
+// when the value cannot be read.
+type Source struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Label   string `json:"label,omitempty"`
+	Default string `json:"default,omitempty"`
+	Path    string `json:"path,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Env     string `json:"env,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+
+	timeout time.Duration
+}
+
+type SourcesConfig struct {
+	Sources []Source `json:"sources"`
+}
+
+// defaultSources reproduces the original hardcoded status view: the log file
+// followed by the ping-pong counter file. The log source includes the
+// per-writer files next to the log file.
+func defaultSources() []Source {
+	ext := filepath.Ext(logFile)
+	return []Source{
+		{Name: "log", Type: "file", Path: strings.TrimSuffix(logFile, ext) + "*" + ext},
+		{Name: "pingpong", Type: "file", Path: counterFile, Label: "Ping / Pongs", Default: "0"},
+	}
+}
+
+// loadSources reads the JSON sources config at path, or returns the default
+// sources when path is empty or the file does not exist, e.g. because the
+// optional ConfigMap is not deployed.
+func loadSources(path string) ([]Source, error) {
+	sources := defaultSources()
+
+	var data []byte
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if os.IsNotExist(err) {
+			log.Printf("Sources config %s does not exist, using the default sources", path)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if data != nil {
+		var config SourcesConfig
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("invalid sources config %s: %w", path, err)
+		}
+		sources = config.Sources
+	}
+
+	seen := make(map[string]bool)
+	var errs []error
+	for i := range sources {
+		s := &sources[i]
+		if err := s.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("source %d (%q): %w", i, s.Name, err))
+		}
+		if seen[s.Name] {
+			errs = append(errs, fmt.Errorf("source %q is declared twice", s.Name))
+		}
+		seen[s.Name] = true
+	}
+	return sources, errors.Join(errs...)
+}
+
+func (s *Source) validate() error {
+	if s.Name == "" || strings.Contains(s.Name, "/") {
+		return errors.New("name is required and must not contain /")
+	}
+
+	s.timeout = defaultSourceTimeout
+	if s.Timeout != "" {
+		d, err := time.ParseDuration(s.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", s.Timeout)
+		}
+		s.timeout = d
+	}
+
+	switch s.Type {
+	case "file":
+		if s.Path == "" {
+			return errors.New("file source needs path")
+		}
+		if _, err := filepath.Match(s.Path, ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q", s.Path)
+		}
+	case "http":
+		if s.URL == "" || s.Field == "" {
+			return errors.New("http source needs url and field")
+		}
+	case "env":
+		if s.Env == "" {
+			return errors.New("env source needs env")
+		}
+	default:
+		return fmt.Errorf("unknown type %q (want file, http or env)", s.Type)
+	}
+	return nil
+}
+
+// Read returns the source's current value.
+func (s *Source) Read(ctx context.Context) (string, error) {
+	switch s.Type {
+	case "file":
+		return s.readFiles()
+	case "http":
+		return s.readHTTP(ctx)
+	case "env":
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown type %q", s.Type)
+}
+
+// readFiles reads Path, or every file matching it in name order, one per
+// line.
+func (s *Source) readFiles() (string, error) {
+	paths, _ := filepath.Glob(s.Path)
+	if len(paths) == 0 {
+		// Reports the file as missing
+		paths = []string{s.Path}
+	}
+
+	values := make([]string, 0, len(paths))
+	for _, path := range paths {
+		data, err := readFileRetry(path)
+		if err != nil {
+			return "", err
+		}
+		if value := strings.TrimSpace(string(data)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, "\n"), nil
+}
+
+func (s *Source) readHTTP(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var body any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	value := body
+	for _, key := range strings.Split(s.Field, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("field %s not found", s.Field)
+		}
+		if value, ok = obj[key]; !ok {
+			return "", fmt.Errorf("field %s not found", s.Field)
+		}
+	}
+
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+// SourceValue is the JSON representation of a source read.
+type SourceValue struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+// readValue reads the source, falling back to Default on error.
+func (s *Source) readValue(ctx context.Context) SourceValue {
+	result := SourceValue{Name: s.Name, Type: s.Type}
+
+	value, err := s.Read(ctx)
+	if err != nil {
+		result.Error = err.Error()
+		value = s.Default
+	}
+	result.Value = value
+	return result
+}
+
+// handleSources serves GET /sources (all values) and GET /sources/{name}.
+func handleSources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/sources"), "/")
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if name == "" {
+		values := make([]SourceValue, 0, len(sources))
+		for i := range sources {
+			values = append(values, sources[i].readValue(r.Context()))
+		}
+		json.NewEncoder(w).Encode(values)
+		return
+	}
+
+	for i := range sources {
+		if sources[i].Name == name {
+			json.NewEncoder(w).Encode(sources[i].readValue(r.Context()))
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("Unknown source %q", name), http.StatusNotFound)
+}
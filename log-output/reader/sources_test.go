@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSources(t *testing.T) {
+	oldLogFile, oldCounterFile := logFile, counterFile
+	t.Cleanup(func() { logFile, counterFile = oldLogFile, oldCounterFile })
+	logFile, counterFile = "/files/output.txt", "/files/pingpong.txt"
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for _, tt := range []struct {
+		name    string
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{"no config", "", []string{"log", "pingpong"}, false},
+		// The ConfigMap volume is optional
+		{"missing config", filepath.Join(dir, "missing.json"), []string{"log", "pingpong"}, false},
+		{"config", write("sources.json", `{"sources": [{"name": "message", "type": "env", "env": "MESSAGE"}]}`), []string{"message"}, false},
+		{"empty config", write("empty.json", ""), nil, true},
+		{"unknown field", write("unknown.json", `{"sources": [], "extra": 1}`), nil, true},
+		{"invalid source", write("invalid.json", `{"sources": [{"name": "log", "type": "file"}]}`), nil, true},
+		{"unreadable config", dir, nil, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sources, err := loadSources(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var names []string
+			for _, s := range sources {
+				names = append(names, s.Name)
+			}
+			if len(names) != len(tt.want) {
+				t.Fatalf("sources = %q, want %q", names, tt.want)
+			}
+			for i := range names {
+				if names[i] != tt.want[i] {
+					t.Errorf("sources = %q, want %q", names, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Heartbeat is the per-writer status file written by the log writer.
+type Heartbeat struct {
+	Writer       string    `json:"writer"`
+	RandomString string    `json:"random_string"`
+	File         string    `json:"file"`
+	Interval     string    `json:"interval"`
+	StartedAt    time.Time `json:"started_at"`
+	LastWrite    time.Time `json:"last_write"`
+	LastLine     string    `json:"last_line"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// WriterStatus is a heartbeat plus whether the writer looks stopped.
+type WriterStatus struct {
+	Heartbeat
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	Age           string    `json:"age"`
+	Stopped       bool      `json:"stopped"`
+}
+
+// staleAfter is how long a writer may go without a heartbeat before it is
+// flagged as stopped. Zero means three of the writer's own tick intervals.
+var staleAfter time.Duration
+
+// writerRetention is how long the heartbeat of a stopped writer is kept.
+// Every replaced pod leaves one behind, so older ones are removed.
+var writerRetention = 24 * time.Hour
+
+// readWriterStatuses reads all heartbeat files in dir, sorted by writer.
+// Heartbeats older than writerRetention are removed.
+func readWriterStatuses(dir string, now time.Time) []WriterStatus {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+
+	statuses := make([]WriterStatus, 0, len(matches))
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var hb Heartbeat
+		if err := json.Unmarshal(data, &hb); err != nil || hb.Writer == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if age := now.Sub(info.ModTime()); age > writerRetention {
+			if err := os.Remove(path); err == nil {
+				log.Printf("Removed the heartbeat of writer %s, last seen %s ago", hb.Writer, age.Truncate(time.Second))
+			}
+			continue
+		}
+
+		threshold := staleAfter
+		if threshold == 0 {
+			interval, err := time.ParseDuration(hb.Interval)
+			if err != nil || interval <= 0 {
+				interval = 5 * time.Second
+			}
+			threshold = 3 * interval
+		}
+
+		age := now.Sub(info.ModTime())
+		statuses = append(statuses, WriterStatus{
+			Heartbeat:     hb,
+			LastHeartbeat: info.ModTime(),
+			Age:           age.Truncate(time.Second).String(),
+			Stopped:       age > threshold,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Writer < statuses[j].Writer })
+	return statuses
+}
+
+// handleWriters serves GET /writers with the status of every known writer.
+func handleWriters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readWriterStatuses(heartbeatDir, time.Now()))
+}
+
+// writerStatusLines renders writer statuses for the plain-text status view.
+func writerStatusLines(statuses []WriterStatus) []string {
+	lines := make([]string, 0, len(statuses))
+	for _, s := range statuses {
+		state := "running"
+		if s.Stopped {
+			state = "STOPPED"
+		}
+		if s.LastError != "" {
+			state += ", error: " + s.LastError
+		}
+		lines = append(lines, fmt.Sprintf("Writer %s: last heartbeat %s (%s ago, %s)",
+			s.Writer, s.LastHeartbeat.Format(time.RFC3339), s.Age, state))
+	}
+	return lines
+}
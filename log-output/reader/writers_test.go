@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOldHeartbeatsAreRemoved(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for writer, age := range map[string]time.Duration{
+		"running": time.Second,
+		"stopped": time.Hour,
+		"gone":    writerRetention + time.Minute,
+	} {
+		path := filepath.Join(dir, writer+".json")
+		if err := os.WriteFile(path, []byte(`{"writer": "`+writer+`", "interval": "5s"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statuses := readWriterStatuses(dir, now)
+	if len(statuses) != 2 || statuses[0].Writer != "running" || statuses[1].Writer != "stopped" {
+		t.Fatalf("statuses = %+v, want running and stopped", statuses)
+	}
+	if statuses[0].Stopped || !statuses[1].Stopped {
+		t.Errorf("stopped = %t, %t, want false, true", statuses[0].Stopped, statuses[1].Stopped)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone.json")); !os.IsNotExist(err) {
+		t.Errorf("heartbeat older than the retention was not removed: %v", err)
+	}
+}
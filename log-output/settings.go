@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the timezone database so TZ_NAME works without tzdata in the image
+	_ "time/tzdata"
+)
+
+// Settings controls how the log line is produced.
+type Settings struct {
+	Location     *time.Location
+	TickInterval time.Duration
+	OutputFormat string
+}
+
+// loadSettings reads TZ_NAME, TICK_INTERVAL and OUTPUT_FORMAT. All invalid
+// values are reported together.
+func loadSettings() (Settings, error) {
+	var errs []error
+	settings := Settings{}
+
+	tzName := envOrDefault("TZ_NAME", "Europe/Helsinki")
+	loc, err := time.LoadLocation(tzName)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("TZ_NAME %q is not a valid IANA timezone: %w", tzName, err))
+	}
+	settings.Location = loc
+
+	interval := envOrDefault("TICK_INTERVAL", "5s")
+	settings.TickInterval, err = time.ParseDuration(interval)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("TICK_INTERVAL %q is not a valid duration (e.g. 5s, 1m): %w", interval, err))
+	} else if settings.TickInterval <= 0 {
+		errs = append(errs, fmt.Errorf("TICK_INTERVAL %q must be positive", interval))
+	}
+
+	settings.OutputFormat = envOrDefault("OUTPUT_FORMAT", "text")
+	switch settings.OutputFormat {
+	case "text", "json", "logfmt":
+	default:
+		errs = append(errs, fmt.Errorf("OUTPUT_FORMAT %q must be one of text, json, logfmt", settings.OutputFormat))
+	}
+
+	return settings, errors.Join(errs...)
+}
+
+func envOrDefault(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// formatLogLine renders one tick of output in the configured format.
+func formatLogLine(format string, timestamp time.Time, randomString string, pong PongCount) string {
+	ts := timestamp.Format(time.RFC3339)
+
+	switch format {
+	case "json":
+		line := struct {
+			Timestamp    string `json:"timestamp"`
+			RandomString string `json:"random_string"`
+			PongCount    *int   `json:"pong_count"`
+			PongStale    bool   `json:"pong_stale"`
+		}{Timestamp: ts, RandomString: randomString, PongStale: pong.Stale || !pong.Known}
+		if pong.Known {
+			line.PongCount = &pong.Count
+		}
+		b, _ := json.Marshal(line)
+		return string(b) + "\n"
+	case "logfmt":
+		count := "unknown"
+		if pong.Known {
+			count = strconv.Itoa(pong.Count)
+		}
+		return fmt.Sprintf("timestamp=%s random_string=%s pong_count=%s pong_stale=%t\n",
+			ts, logfmtValue(randomString), count, pong.Stale || !pong.Known)
+	default:
+		return fmt.Sprintf("%s: %s.\nPing / Pongs: %s\n", ts, randomString, formatPongCount(pong, time.Now()))
+	}
+}
+
+// logfmtValue quotes a value if logfmt requires it.
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
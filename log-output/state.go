@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InstanceState identifies this instance across restarts. It is persisted to
+// STATE_FILE so a restarted pod keeps its random string; a new replica gets a
+// new one.
+type InstanceState struct {
+	ID           string    `json:"id"`
+	FirstStart   time.Time `json:"first_start"`
+	LastStart    time.Time `json:"last_start"`
+	RestartCount int       `json:"restart_count"`
+}
+
+// loadInstanceState reads the state at path and records this start in it.
+// Without a path, or if the file is missing, a new identity is created. A
+// corrupt file is logged and replaced rather than stopping the application.
+func loadInstanceState(path string, now time.Time) (InstanceState, error) {
+	if path == "" {
+		return InstanceState{ID: uuid.New().String(), FirstStart: now, LastStart: now}, nil
+	}
+
+	var st InstanceState
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &st); err != nil || st.ID == "" {
+			fmt.Printf("Ignoring invalid state file %s: %v\n", path, err)
+			st = InstanceState{}
+		}
+	case !os.IsNotExist(err):
+		return st, fmt.Errorf("failed to read state file %s: %w", path, err)
+	}
+
+	if st.ID == "" {
+		st = InstanceState{ID: uuid.New().String(), FirstStart: now}
+	} else {
+		st.RestartCount++
+	}
+	st.LastStart = now
+
+	if err := saveInstanceState(path, st); err != nil {
+		return st, err
+	}
+	return st, nil
+}
+
+// saveInstanceState writes the state through a temp file and rename, so a
+// crash mid-write never leaves a truncated state file behind.
+func saveInstanceState(path string, st InstanceState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write state file %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write state file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var statusTemplate = template.Must(template.ParseFS(templateFS, "templates/status.html"))
+
+// StatusResponse is the JSON representation of the status page.
+type StatusResponse struct {
+	Timestamp    time.Time  `json:"timestamp"`
+	RandomString string     `json:"random_string"`
+	FirstStart   time.Time  `json:"first_started_at"`
+	StartedAt    time.Time  `json:"started_at"`
+	RestartCount int        `json:"restart_count"`
+	Persistent   bool       `json:"state_persisted"`
+	PongCount    *int       `json:"pong_count"`
+	PongStale    bool       `json:"pong_stale"`
+	PongStaleFor string     `json:"pong_stale_for,omitempty"`
+	PongUpdated  *time.Time `json:"pong_updated_at,omitempty"`
+	FileContent  string     `json:"file_content"`
+	Message      string     `json:"message"`
+}
+
+type statusPage struct {
+	Timestamp    string
+	RandomString string
+	FirstStart   string
+	StartedAt    string
+	RestartCount int
+	Persistent   bool
+	PongCount    string
+	PongStatus   string
+	FileContent  string
+	Message      string
+}
+
+type statusSnapshot struct {
+	lastUpdate   time.Time
+	randomString string
+	instance     InstanceState
+	persisted    bool
+	pong         PongCount
+	fileContent  string
+	message      string
+}
+
+func currentStatus() statusSnapshot {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	return statusSnapshot{
+		lastUpdate:   state.lastUpdate,
+		randomString: state.randomString,
+		instance:     state.instance,
+		persisted:    state.persisted,
+		pong:         state.pong,
+		fileContent:  state.fileContent,
+		message:      state.message,
+	}
+}
+
+// handleStatus serves the status page as HTML, JSON (Accept: application/json
+// or ?format=json) or plain text (?format=text).
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	switch statusFormat(r) {
+	case "json":
+		writeStatusJSON(w, currentStatus())
+	case "text":
+		writeStatusText(w, currentStatus())
+	default:
+		writeStatusHTML(w, currentStatus())
+	}
+}
+
+// handleStatusJSON always returns JSON.
+func handleStatusJSON(w http.ResponseWriter, r *http.Request) {
+	writeStatusJSON(w, currentStatus())
+}
+
+func statusFormat(r *http.Request) string {
+	switch format := r.URL.Query().Get("format"); format {
+	case "json", "text", "html":
+		return format
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/html":
+			return "html"
+		case "application/json":
+			return "json"
+		case "text/plain":
+			return "text"
+		}
+	}
+
+	return "html"
+}
+
+func writeStatusJSON(w http.ResponseWriter, s statusSnapshot) {
+	resp := StatusResponse{
+		Timestamp:    s.lastUpdate,
+		RandomString: s.randomString,
+		FirstStart:   s.instance.FirstStart,
+		StartedAt:    s.instance.LastStart,
+		RestartCount: s.instance.RestartCount,
+		Persistent:   s.persisted,
+		PongStale:    s.pong.Stale || !s.pong.Known,
+		FileContent:  s.fileContent,
+		Message:      s.message,
+	}
+	if s.pong.Known {
+		count := s.pong.Count
+		resp.PongCount = &count
+		resp.PongUpdated = &s.pong.LastSuccess
+	}
+	if s.pong.Stale && s.pong.Known {
+		resp.PongStaleFor = s.pong.StaleFor(time.Now()).String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding status JSON: %v", err)
+	}
+}
+
+// writeStatusText writes the same lines as the text log format, which the
+// log reader serves with the trailing newline trimmed.
+func writeStatusText(w http.ResponseWriter, s statusSnapshot) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, strings.TrimSuffix(formatLogLine("text", s.lastUpdate, s.randomString, s.pong), "\n"))
+}
+
+func writeStatusHTML(w http.ResponseWriter, s statusSnapshot) {
+	page := statusPage{
+		Timestamp:    s.lastUpdate.Format("2006-01-02 15:04:05 MST"),
+		RandomString: s.randomString,
+		FirstStart:   s.instance.FirstStart.Format("2006-01-02 15:04:05 MST"),
+		StartedAt:    s.instance.LastStart.Format("2006-01-02 15:04:05 MST"),
+		RestartCount: s.instance.RestartCount,
+		Persistent:   s.persisted,
+		PongCount:    "-",
+		PongStatus:   "Up to date",
+		FileContent:  s.fileContent,
+		Message:      s.message,
+	}
+
+	if s.pong.Known {
+		page.PongCount = fmt.Sprintf("%d", s.pong.Count)
+	}
+	if !s.pong.Known {
+		page.PongStatus = "Unavailable: " + s.pong.LastError
+	} else if s.pong.Stale {
+		page.PongStatus = fmt.Sprintf("Stale for %s (last updated %s): %s",
+			s.pong.StaleFor(time.Now()), s.pong.LastSuccess.Format("2006-01-02 15:04:05 MST"), s.pong.LastError)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, page); err != nil {
+		log.Printf("Error rendering status page: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusTextMatchesLogLine(t *testing.T) {
+	timestamp := time.Date(2025, 12, 1, 12, 0, 5, 0, time.UTC)
+	for _, pong := range []PongCount{
+		{Known: true, Count: 3},
+		{Known: false},
+	} {
+		s := statusSnapshot{lastUpdate: timestamp, randomString: "0b6f5c1e", pong: pong}
+		w := httptest.NewRecorder()
+		writeStatusText(w, s)
+
+		logLine := formatLogLine("text", timestamp, "0b6f5c1e", pong)
+		if got, want := w.Body.String(), strings.TrimSpace(logLine); got != want {
+			t.Errorf("status text = %q, want the log line %q", got, want)
+		}
+		if !strings.HasPrefix(w.Body.String(), "2025-12-01T12:00:05Z: 0b6f5c1e.\nPing / Pongs: ") {
+			t.Errorf("status text = %q", w.Body.String())
+		}
+	}
+}
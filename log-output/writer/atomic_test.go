@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// atomicContent returns the nth version of a file. The versions differ in
+// length, so a read that mixes two of them or stops early is detectable.
+func atomicContent(n int) string {
+	return fmt.Sprintf("%d:%s\n", n, strings.Repeat("x", 1+n%97*41))
+}
+
+func validAtomicContent(data string) bool {
+	var n int
+	if _, err := fmt.Sscanf(data, "%d:", &n); err != nil {
+		return false
+	}
+	return data == atomicContent(n)
+}
+
+func TestWriteFileAtomicWithConcurrentReaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	if err := writeFileAtomic(path, []byte(atomicContent(0)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reads, bad := 0, []string{}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// A plain read, without the reader's retry on empty files
+				data, err := os.ReadFile(path)
+				mu.Lock()
+				reads++
+				if err != nil || !validAtomicContent(string(data)) {
+					bad = append(bad, fmt.Sprintf("%q (err %v)", data, err))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	writes := 0
+	for n := 1; n < 2000 && time.Now().Before(deadline); n++ {
+		if err := writeFileAtomic(path, []byte(atomicContent(n)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		writes++
+	}
+	close(done)
+	wg.Wait()
+
+	if len(bad) > 0 {
+		t.Errorf("%d of %d reads saw a torn or empty file, e.g. %s", len(bad), reads, bad[0])
+	}
+	t.Logf("%d writes, %d reads", writes, reads)
+
+	// No temp files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory has %q, want only output.txt", names)
+	}
+}
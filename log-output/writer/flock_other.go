@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+type fileLock struct{}
+
+func openFileLock(path string) (*fileLock, error) {
+	return nil, errors.New("COORDINATION=flock is only supported on unix")
+}
+
+func (l *fileLock) Lock() error   { return os.ErrInvalid }
+func (l *fileLock) Unlock() error { return os.ErrInvalid }
+func (l *fileLock) Close() error  { return nil }
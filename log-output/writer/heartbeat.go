@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Heartbeat is written by every writer on each tick so the reader can show
+// per-writer status and detect writers that have stopped.
+type Heartbeat struct {
+	Writer       string    `json:"writer"`
+	RandomString string    `json:"random_string"`
+	File         string    `json:"file"`
+	Interval     string    `json:"interval"`
+	StartedAt    time.Time `json:"started_at"`
+	LastWrite    time.Time `json:"last_write"`
+	LastLine     string    `json:"last_line"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+func writeHeartbeat(dir string, hb Heartbeat) error {
+	data, err := json.Marshal(hb)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, hb.Writer+".json"), data, 0644)
+}
+
+func ensureDir(dir string) error {
+	return os.MkdirAll(dir, 0755)
+}
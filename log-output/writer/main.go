@@ -2,41 +2,90 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 func main() {
-	// Generate a random string on startup
-	randomString := uuid.New().String()
-
-	// Load Helsinki timezone
-	loc, err := time.LoadLocation("Europe/Helsinki")
+	settings, err := loadSettings()
 	if err != nil {
-		fmt.Printf("Warning: Could not load Europe/Helsinki timezone, using UTC: %v\n", err)
-		loc = time.UTC
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
+	// Generate a random string on startup
+	randomString := uuid.New().String()
+
 	fmt.Println("Log writer started")
 	fmt.Printf("Random string: %s\n", randomString)
-	fmt.Printf("Timezone: %s\n", loc.String())
+	fmt.Printf("Timezone: %s\n", settings.Location.String())
+	fmt.Printf("Tick interval: %s\n", settings.TickInterval)
+	fmt.Printf("Output format: %s\n", settings.OutputFormat)
+	fmt.Printf("Writer: %s (coordination: %s)\n", settings.WriterID, settings.Coordination)
+	fmt.Printf("Output file: %s (%s mode)\n", settings.OutputFile, settings.WriteMode)
+	fmt.Printf("Heartbeat dir: %s\n", settings.HeartbeatDir)
+
+	if err := ensureDir(settings.HeartbeatDir); err != nil {
+		log.Fatalf("Failed to create heartbeat directory: %v", err)
+	}
+
+	write := func(line string) error {
+		return writeFileAtomic(settings.OutputFile, []byte(line), 0644)
+	}
+
+	if settings.WriteMode == "append" {
+		var lock *fileLock
+		if settings.Coordination == "flock" {
+			lock, err = openFileLock(settings.OutputFile + ".lock")
+			if err != nil {
+				log.Fatalf("Failed to open lock file: %v", err)
+			}
+			defer lock.Close()
+		}
+
+		rf, err := OpenRotatingFile(settings.OutputFile, settings.Rotation, lock)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", settings.OutputFile, err)
+		}
+		defer rf.Close()
+		write = rf.WriteLine
+
+		fmt.Printf("Rotation: max size %d bytes, max age %s, %s naming, compress %t, retain %d\n",
+			settings.Rotation.MaxSize, settings.Rotation.MaxAge, settings.Rotation.Naming,
+			settings.Rotation.Compress, settings.Rotation.Retain)
+	}
 
-	// Write to file every 5 seconds
-	ticker := time.NewTicker(5 * time.Second)
+	// Write to file every tick
+	ticker := time.NewTicker(settings.TickInterval)
 	defer ticker.Stop()
 
+	heartbeat := Heartbeat{
+		Writer:       settings.WriterID,
+		RandomString: randomString,
+		File:         settings.OutputFile,
+		Interval:     settings.TickInterval.String(),
+		StartedAt:    time.Now().UTC(),
+	}
+
 	for range ticker.C {
-		timestamp := time.Now().In(loc).Format(time.RFC3339)
-		logLine := fmt.Sprintf("%s: %s\n", timestamp, randomString)
+		now := time.Now().In(settings.Location)
+		logLine := formatLogLine(settings.OutputFormat, now, randomString, settings.WriterID)
 
 		// Write to shared file
-		err := os.WriteFile("/usr/src/app/files/output.txt", []byte(logLine), 0644)
-		if err != nil {
+		if err := write(logLine); err != nil {
 			fmt.Printf("Error writing to file: %v\n", err)
+			heartbeat.LastError = err.Error()
 		} else {
 			fmt.Print(logLine)
+			heartbeat.LastWrite = now.UTC()
+			heartbeat.LastLine = strings.TrimSuffix(logLine, "\n")
+			heartbeat.LastError = ""
+		}
+
+		if err := writeHeartbeat(settings.HeartbeatDir, heartbeat); err != nil {
+			fmt.Printf("Error writing heartbeat: %v\n", err)
 		}
 	}
 }
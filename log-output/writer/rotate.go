@@ -0,0 +1,312 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotationTimeFormat is used for timestamped segment names. It sorts
+// lexically and contains no characters that need escaping in file names.
+// The nanoseconds keep rotations within the same second apart.
+const rotationTimeFormat = "20060102T150405.000000000Z"
+
+// rotationTimeParseFormat parses segment names with or without fractional
+// seconds.
+const rotationTimeParseFormat = "20060102T150405Z"
+
+// RotationConfig controls when and how the output file is rotated.
+// A zero MaxSize or MaxAge disables that trigger.
+type RotationConfig struct {
+	MaxSize  int64
+	MaxAge   time.Duration
+	Naming   string // "numbered" (output.txt.1..N) or "timestamp"
+	Compress bool
+	Retain   int
+}
+
+// RotatingFile appends lines to a file and rotates it by size or age. When
+// lock is set, several writers can share the file: each write and rotation
+// happens under the lock, and a writer reopens the file after another writer
+// has rotated it.
+type RotatingFile struct {
+	path   string
+	config RotationConfig
+	lock   *fileLock
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func OpenRotatingFile(path string, config RotationConfig, lock *fileLock) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, config: config, lock: lock}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	if r.size > 0 {
+		// An existing file is at least as old as its last write
+		r.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// WriteLine appends line, rotating first if a trigger has been reached.
+func (r *RotatingFile) WriteLine(line string) error {
+	if r.lock != nil {
+		if err := r.lock.Lock(); err != nil {
+			return fmt.Errorf("failed to lock %s: %w", r.path, err)
+		}
+		defer r.lock.Unlock()
+
+		if err := r.syncWithDisk(); err != nil {
+			return err
+		}
+	}
+
+	if r.shouldRotate(int64(len(line))) {
+		if err := r.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", r.path, err)
+		}
+	}
+
+	n, err := r.file.WriteString(line)
+	r.size += int64(n)
+	return err
+}
+
+// syncWithDisk picks up changes made by other writers: appended lines grow
+// the size, and a rotation replaces the file at path.
+func (r *RotatingFile) syncWithDisk() error {
+	current, err := os.Stat(r.path)
+	if err == nil {
+		opened, statErr := r.file.Stat()
+		if statErr == nil && os.SameFile(current, opened) {
+			r.size = current.Size()
+			return nil
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Rotated by another writer
+	r.file.Close()
+	if err := r.open(); err != nil {
+		return err
+	}
+	if r.size == 0 {
+		r.openedAt = time.Now()
+	}
+	return nil
+}
+
+func (r *RotatingFile) Close() error {
+	return r.file.Close()
+}
+
+func (r *RotatingFile) shouldRotate(next int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.config.MaxSize > 0 && r.size+next > r.config.MaxSize {
+		return true
+	}
+	if r.config.MaxAge > 0 && time.Since(r.openedAt) >= r.config.MaxAge {
+		return true
+	}
+	return false
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	var rotated string
+	var err error
+	if r.config.Naming == "timestamp" {
+		rotated, err = r.rotateTimestamped()
+	} else {
+		rotated, err = r.rotateNumbered()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rotated %s to %s\n", r.path, rotated)
+
+	if r.config.Compress {
+		if err := gzipFile(rotated); err != nil {
+			fmt.Printf("Error compressing %s: %v\n", rotated, err)
+		}
+	}
+
+	return r.open()
+}
+
+// rotateNumbered shifts output.txt.N-1 to output.txt.N, dropping segments
+// beyond the retention count, and moves the current file to output.txt.1.
+func (r *RotatingFile) rotateNumbered() (string, error) {
+	for i := r.config.Retain; i >= 1; i-- {
+		for _, ext := range []string{"", ".gz"} {
+			src := fmt.Sprintf("%s.%d%s", r.path, i, ext)
+			if i == r.config.Retain {
+				os.Remove(src)
+				continue
+			}
+			dst := fmt.Sprintf("%s.%d%s", r.path, i+1, ext)
+			if err := os.Rename(src, dst); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+	}
+
+	rotated := r.path + ".1"
+	return rotated, os.Rename(r.path, rotated)
+}
+
+// rotateTimestamped moves the current file to output.txt.<UTC timestamp> and
+// removes the oldest segments beyond the retention count. If a segment with
+// that name already exists, a counter is appended (output.txt.<timestamp>-1)
+// so it is never overwritten.
+func (r *RotatingFile) rotateTimestamped() (string, error) {
+	rotated := unusedSegmentName(r.path + "." + time.Now().UTC().Format(rotationTimeFormat))
+	if err := os.Rename(r.path, rotated); err != nil {
+		return "", err
+	}
+
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return rotated, err
+	}
+
+	// Only timestamped segments count, not e.g. the flock file
+	var segments []string
+	for _, match := range matches {
+		if isTimestampSegment(strings.TrimPrefix(match, r.path+".")) {
+			segments = append(segments, match)
+		}
+	}
+	// Oldest first; a counter suffix sorts after the name without one
+	sort.Slice(segments, func(i, j int) bool {
+		return strings.TrimSuffix(segments[i], ".gz") < strings.TrimSuffix(segments[j], ".gz")
+	})
+
+	// Keep the newest Retain segments; the one just rotated is always kept
+	for len(segments) > r.config.Retain && segments[0] != rotated {
+		if err := os.Remove(segments[0]); err != nil {
+			return rotated, err
+		}
+		segments = segments[1:]
+	}
+	return rotated, nil
+}
+
+// isTimestampSegment reports whether suffix is the part of a timestamped
+// segment name after "output.txt.", e.g. 20251201T120005.123456789Z-1.gz.
+func isTimestampSegment(suffix string) bool {
+	suffix = strings.TrimSuffix(suffix, ".gz")
+	if i := strings.LastIndex(suffix, "Z-"); i >= 0 {
+		if _, err := strconv.Atoi(suffix[i+2:]); err != nil {
+			return false
+		}
+		suffix = suffix[:i+1]
+	}
+	_, err := time.Parse(rotationTimeParseFormat, suffix)
+	return err == nil
+}
+
+// unusedSegmentName returns base, or base-1, base-2, ... if a segment with
+// that name already exists, compressed or not.
+func unusedSegmentName(base string) string {
+	name := base
+	for n := 1; exists(name) || exists(name+".gz"); n++ {
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	return name
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// gzipFile replaces path with path.gz.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// parseSize parses a byte size such as 1048576, 512K, 10MB or 1G.
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(value, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	var n int64
+	if _, err := fmt.Sscanf(value, "%d", &n); err != nil || n < 0 || fmt.Sprint(n) != value {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// rotatedSegments returns the names of the rotated segments next to path.
+func rotatedSegments(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, match := range matches {
+		names = append(names, filepath.Base(match))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readSegment(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestTimestampedRotationsInTheSameSecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	// Every line after the first rotates the file
+	r, err := OpenRotatingFile(path, RotationConfig{MaxSize: 1, Naming: "timestamp", Retain: 10}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	lines := []string{"a\n", "b\n", "c\n", "d\n", "e\n"}
+	for _, line := range lines {
+		if err := r.WriteLine(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Four rotations, well within a second, and no segment overwritten
+	segments := rotatedSegments(t, path)
+	if len(segments) != 4 {
+		t.Fatalf("segments = %q, want 4", segments)
+	}
+	var content []string
+	for _, segment := range segments {
+		if !isTimestampSegment(strings.TrimPrefix(segment, "output.txt.")) {
+			t.Errorf("%s is not a timestamped segment name", segment)
+		}
+		content = append(content, readSegment(t, filepath.Join(filepath.Dir(path), segment)))
+	}
+	if got, want := strings.Join(content, ""), "a\nb\nc\nd\n"; got != want {
+		t.Errorf("segments hold %q oldest first, want %q", got, want)
+	}
+}
+
+func TestUnusedSegmentName(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "output.txt.20251201T120005.000000000Z")
+	if got := unusedSegmentName(base); got != base {
+		t.Errorf("free name = %s, want %s", got, base)
+	}
+
+	// Taken by an earlier rotation in the same tick, compressed or not
+	for _, taken := range []string{base, base + "-1.gz"} {
+		if err := os.WriteFile(taken, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := unusedSegmentName(base); got != base+"-2" {
+		t.Errorf("name = %s, want %s-2", got, base)
+	}
+}
+
+func TestIsTimestampSegment(t *testing.T) {
+	for suffix, want := range map[string]bool{
+		"20251201T120005.000000000Z":      true,
+		"20251201T120005.123456789Z-1":    true,
+		"20251201T120005.123456789Z-2.gz": true,
+		// Written before segment names had nanoseconds
+		"20251201T120005Z":       true,
+		"20251201T120005Z.gz":    true,
+		"lock":                   false,
+		"1":                      false,
+		"1.gz":                   false,
+		"20251201T120005Z-x":     false,
+		"20251201T120005Z-1-tmp": false,
+	} {
+		if got := isTimestampSegment(suffix); got != want {
+			t.Errorf("isTimestampSegment(%q) = %t, want %t", suffix, got, want)
+		}
+	}
+}
+
+func TestTimestampedRotationRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	r, err := OpenRotatingFile(path, RotationConfig{MaxSize: 1, Naming: "timestamp", Compress: true, Retain: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"a\n", "b\n", "c\n", "d\n", "e\n"} {
+		if err := r.WriteLine(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segments := rotatedSegments(t, path)
+	if len(segments) != 2 {
+		t.Fatalf("segments = %q, want the newest 2", segments)
+	}
+	for _, segment := range segments {
+		if !strings.HasSuffix(segment, ".gz") {
+			t.Errorf("%s is not compressed", segment)
+		}
+	}
+}
+
+func TestNumberedRotationRetainsOne(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.txt")
+	r, err := OpenRotatingFile(path, RotationConfig{MaxSize: 1, Naming: "numbered", Compress: true, Retain: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		if err := r.WriteLine(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if segments := rotatedSegments(t, path); len(segments) != 1 || segments[0] != "output.txt.1.gz" {
+		t.Errorf("segments = %q, want only output.txt.1.gz", segments)
+	}
+	if got := readSegment(t, path); got != "c\n" {
+		t.Errorf("output.txt = %q, want the last line", got)
+	}
+}
+
+func TestRotateRetainMustBePositive(t *testing.T) {
+	t.Setenv("POD_NAME", "writer-0")
+	for retain, valid := range map[string]bool{"1": true, "5": true, "0": false, "-1": false, "many": false} {
+		t.Setenv("ROTATE_RETAIN", retain)
+		settings, err := loadSettings()
+		if valid && (err != nil || settings.Rotation.Retain < 1) {
+			t.Errorf("ROTATE_RETAIN=%s: %v", retain, err)
+		}
+		if !valid && (err == nil || !strings.Contains(err.Error(), "ROTATE_RETAIN")) {
+			t.Errorf("ROTATE_RETAIN=%s: err = %v, want it rejected", retain, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the timezone database so TZ_NAME works without tzdata in the image
+	_ "time/tzdata"
+)
+
+// Settings controls how the log line is produced.
+type Settings struct {
+	Location     *time.Location
+	TickInterval time.Duration
+	OutputFormat string
+	OutputFile   string
+	WriteMode    string
+	Rotation     RotationConfig
+
+	// WriterID identifies this writer in log lines and heartbeats
+	WriterID     string
+	Coordination string
+	HeartbeatDir string
+}
+
+// loadSettings reads the line format (TZ_NAME, TICK_INTERVAL, OUTPUT_FORMAT),
+// the output file and how it is written (OUTPUT_FILE, WRITE_MODE, the
+// ROTATE_* variables), and how writers share it (the writer ID from POD_NAME
+// or the hostname, COORDINATION as none, per-writer or flock, and
+// HEARTBEAT_DIR). All invalid values are reported together.
+func loadSettings() (Settings, error) {
+	var errs []error
+	settings := Settings{}
+
+	tzName := envOrDefault("TZ_NAME", "Europe/Helsinki")
+	loc, err := time.LoadLocation(tzName)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("TZ_NAME %q is not a valid IANA timezone: %w", tzName, err))
+	}
+	settings.Location = loc
+
+	interval := envOrDefault("TICK_INTERVAL", "5s")
+	settings.TickInterval, err = time.ParseDuration(interval)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("TICK_INTERVAL %q is not a valid duration (e.g. 5s, 1m): %w", interval, err))
+	} else if settings.TickInterval <= 0 {
+		errs = append(errs, fmt.Errorf("TICK_INTERVAL %q must be positive", interval))
+	}
+
+	settings.OutputFormat = envOrDefault("OUTPUT_FORMAT", "text")
+	switch settings.OutputFormat {
+	case "text", "json", "logfmt":
+	default:
+		errs = append(errs, fmt.Errorf("OUTPUT_FORMAT %q must be one of text, json, logfmt", settings.OutputFormat))
+	}
+
+	settings.OutputFile = envOrDefault("OUTPUT_FILE", "/usr/src/app/files/output.txt")
+
+	settings.WriterID = os.Getenv("POD_NAME")
+	if settings.WriterID == "" {
+		settings.WriterID, _ = os.Hostname()
+	}
+	if settings.WriterID == "" || strings.ContainsAny(settings.WriterID, "/\\ ") {
+		errs = append(errs, fmt.Errorf("writer ID %q from POD_NAME or hostname must be non-empty without slashes or spaces", settings.WriterID))
+	}
+
+	settings.Coordination = envOrDefault("COORDINATION", "none")
+	switch settings.Coordination {
+	case "none":
+	case "per-writer":
+		ext := filepath.Ext(settings.OutputFile)
+		settings.OutputFile = strings.TrimSuffix(settings.OutputFile, ext) + "-" + settings.WriterID + ext
+	case "flock":
+	default:
+		errs = append(errs, fmt.Errorf("COORDINATION %q must be none, per-writer or flock", settings.Coordination))
+	}
+
+	settings.HeartbeatDir = envOrDefault("HEARTBEAT_DIR", filepath.Join(filepath.Dir(settings.OutputFile), "writers"))
+
+	settings.WriteMode = envOrDefault("WRITE_MODE", "overwrite")
+	switch settings.WriteMode {
+	case "overwrite", "append":
+	default:
+		errs = append(errs, fmt.Errorf("WRITE_MODE %q must be overwrite or append", settings.WriteMode))
+	}
+
+	if maxSize := os.Getenv("ROTATE_MAX_SIZE"); maxSize != "" {
+		settings.Rotation.MaxSize, err = parseSize(maxSize)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ROTATE_MAX_SIZE: %w (e.g. 1048576, 512K, 10MB)", err))
+		}
+	}
+
+	if maxAge := os.Getenv("ROTATE_MAX_AGE"); maxAge != "" {
+		settings.Rotation.MaxAge, err = time.ParseDuration(maxAge)
+		if err != nil || settings.Rotation.MaxAge < 0 {
+			errs = append(errs, fmt.Errorf("ROTATE_MAX_AGE %q is not a valid duration (e.g. 1h)", maxAge))
+		}
+	}
+
+	settings.Rotation.Naming = envOrDefault("ROTATE_NAMING", "numbered")
+	switch settings.Rotation.Naming {
+	case "numbered", "timestamp":
+	default:
+		errs = append(errs, fmt.Errorf("ROTATE_NAMING %q must be numbered or timestamp", settings.Rotation.Naming))
+	}
+
+	compress := envOrDefault("ROTATE_COMPRESS", "false")
+	settings.Rotation.Compress, err = strconv.ParseBool(compress)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("ROTATE_COMPRESS %q must be true or false", compress))
+	}
+
+	retain := envOrDefault("ROTATE_RETAIN", "5")
+	settings.Rotation.Retain, err = strconv.Atoi(retain)
+	if err != nil || settings.Rotation.Retain < 1 {
+		errs = append(errs, fmt.Errorf("ROTATE_RETAIN %q must be a positive integer", retain))
+	}
+
+	if settings.Coordination == "flock" && settings.WriteMode != "append" {
+		errs = append(errs, errors.New("COORDINATION=flock requires WRITE_MODE=append"))
+	}
+
+	return settings, errors.Join(errs...)
+}
+
+func envOrDefault(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// formatLogLine renders one log line in the configured format. Every format
+// starts with or contains the RFC3339 timestamp.
+func formatLogLine(format string, timestamp time.Time, randomString, writerID string) string {
+	ts := timestamp.Format(time.RFC3339)
+
+	switch format {
+	case "json":
+		b, _ := json.Marshal(struct {
+			Timestamp    string `json:"timestamp"`
+			RandomString string `json:"random_string"`
+			Writer       string `json:"writer"`
+		}{ts, randomString, writerID})
+		return string(b) + "\n"
+	case "logfmt":
+		return fmt.Sprintf("timestamp=%s random_string=%s writer=%s\n",
+			ts, logfmtValue(randomString), logfmtValue(writerID))
+	default:
+		return fmt.Sprintf("%s: %s [%s]\n", ts, randomString, writerID)
+	}
+}
+
+// logfmtValue quotes a value if logfmt requires it.
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// adminTokens maps each bearer token accepted by the /admin endpoints to
+// the name of the operator it belongs to. When it is empty the admin API is
+// disabled.
+var adminTokens map[string]string
+
+// AdminActor identifies who made an admin request. Name comes from the
+// token; ClaimedName is the unverified X-Admin-Actor header, if any.
+type AdminActor struct {
+	Name             string
+	ClaimedName      string
+	TokenFingerprint string
+	RemoteAddr       string
+}
+
+func (a AdminActor) String() string {
+	s := fmt.Sprintf("%s@%s", a.Name, a.RemoteAddr)
+	if a.ClaimedName != "" && a.ClaimedName != a.Name {
+		s += fmt.Sprintf(" (claimed %q)", a.ClaimedName)
+	}
+	return s
+}
+
+type Snapshot struct {
+	Count   int       `json:"count"`
+	TakenAt time.Time `json:"taken_at"`
+}
+
+type SetCountRequest struct {
+	Count *int `json:"count"`
+}
+
+func initAdminDB() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS admin_audit (
+			id SERIAL PRIMARY KEY,
+			action TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			old_count INTEGER,
+			new_count INTEGER,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Added after the table was first created
+	_, err = db.Exec(`
+		ALTER TABLE admin_audit
+			ADD COLUMN IF NOT EXISTS claimed_actor TEXT,
+			ADD COLUMN IF NOT EXISTS token_fingerprint TEXT
+	`)
+	return err
+}
+
+// parseAdminTokens reads ADMIN_TOKENS, a comma-separated list of name:token
+// pairs, and ADMIN_TOKEN, a single token for the operator "admin".
+func parseAdminTokens(tokenList, token string) (map[string]string, error) {
+	tokens := map[string]string{}
+	add := func(name, token string) error {
+		if name == "" || token == "" {
+			return fmt.Errorf("operator name and token must not be empty")
+		}
+		if other, ok := tokens[token]; ok {
+			return fmt.Errorf("%s and %s share a token", other, name)
+		}
+		tokens[token] = name
+		return nil
+	}
+
+	for i, entry := range strings.Split(tokenList, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(entry, ":")
+		if !ok {
+			// The entry may be a bare token, so it is not echoed
+			return nil, fmt.Errorf("entry %d is not name:token", i+1)
+		}
+		if err := add(strings.TrimSpace(name), strings.TrimSpace(token)); err != nil {
+			return nil, err
+		}
+	}
+
+	if token != "" {
+		if err := add("admin", token); err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
+// tokenFingerprint identifies a token in the audit log without revealing it.
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:6])
+}
+
+func registerAdminHandlers() {
+	http.HandleFunc("/admin/reset", requireAdmin(http.MethodPost, handleAdminReset))
+	http.HandleFunc("/admin/count", requireAdmin(http.MethodPut, handleAdminSetCount))
+	http.HandleFunc("/admin/snapshot", requireAdmin(http.MethodGet, handleAdminSnapshot))
+	http.HandleFunc("/admin/restore", requireAdmin(http.MethodPost, handleAdminRestore))
+}
+
+// requireAdmin checks the method and bearer token before calling next.
+// The actor recorded in the audit log is the operator the token belongs to;
+// the X-Admin-Actor header is only recorded as the claimed actor.
+func requireAdmin(method string, next func(w http.ResponseWriter, r *http.Request, actor AdminActor)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(adminTokens) == 0 {
+			http.Error(w, "Admin API disabled", http.StatusNotFound)
+			return
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		name := ""
+		if ok {
+			// Compare against every token so the time taken does not
+			// reveal which one matched
+			for candidate, operator := range adminTokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+					name = operator
+				}
+			}
+		}
+		if name == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ping-pong-admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Printf("%s %s - Unauthorized admin request from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			return
+		}
+
+		next(w, r, AdminActor{
+			Name:             name,
+			ClaimedName:      strings.TrimSpace(r.Header.Get("X-Admin-Actor")),
+			TokenFingerprint: tokenFingerprint(token),
+			RemoteAddr:       r.RemoteAddr,
+		})
+	}
+}
+
+// AuditEntry is one row of the admin_audit table. OldCount and NewCount are
+// nil when the action does not read or change the counter.
+type AuditEntry struct {
+	Action   string
+	Actor    AdminActor
+	OldCount *int
+	NewCount *int
+}
+
+// AdminStore changes and reads the counter for the admin API, writing an
+// audit entry in the same transaction.
+type AdminStore interface {
+	// SetCount sets the counter and returns the previous value.
+	SetCount(ctx context.Context, action string, actor AdminActor, count int) (int, error)
+	// Snapshot returns the counter.
+	Snapshot(ctx context.Context, actor AdminActor) (int, error)
+}
+
+var adminStore AdminStore
+
+// postgresAdminStore keeps the audit log in the admin_audit table.
+type postgresAdminStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAdminStore(db *sql.DB) AdminStore {
+	return &postgresAdminStore{db: db}
+}
+
+func (s *postgresAdminStore) SetCount(ctx context.Context, action string, actor AdminActor, count int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var old int
+	if err := tx.QueryRowContext(ctx, "SELECT count FROM counter WHERE id = 1 FOR UPDATE").Scan(&old); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE counter SET count = $1 WHERE id = 1", count); err != nil {
+		return 0, err
+	}
+
+	if err := writeAudit(ctx, tx, AuditEntry{action, actor, &old, &count}); err != nil {
+		return 0, err
+	}
+
+	return old, tx.Commit()
+}
+
+func (s *postgresAdminStore) Snapshot(ctx context.Context, actor AdminActor) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT count FROM counter WHERE id = 1").Scan(&count); err != nil {
+		return 0, err
+	}
+
+	if err := writeAudit(ctx, tx, AuditEntry{"snapshot", actor, &count, nil}); err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit()
+}
+
+func writeAudit(ctx context.Context, tx *sql.Tx, entry AuditEntry) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO admin_audit (action, actor, claimed_actor, token_fingerprint, old_count, new_count)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		auditValues(entry)...,
+	)
+	return err
+}
+
+// auditValues returns the admin_audit columns for entry. The actor column
+// holds the operator the token belongs to; claimed_actor is NULL unless the
+// request named one.
+func auditValues(entry AuditEntry) []any {
+	var claimed *string
+	if entry.Actor.ClaimedName != "" {
+		claimed = &entry.Actor.ClaimedName
+	}
+	return []any{
+		entry.Action,
+		entry.Actor.Name + "@" + entry.Actor.RemoteAddr,
+		claimed,
+		entry.Actor.TokenFingerprint,
+		entry.OldCount,
+		entry.NewCount,
+	}
+}
+
+func handleAdminReset(w http.ResponseWriter, r *http.Request, actor AdminActor) {
+	old, err := adminStore.SetCount(r.Context(), "reset", actor, 0)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /admin/reset - Database error: %v", err)
+		return
+	}
+	store.Publish(0)
+
+	log.Printf("POST /admin/reset - Counter reset from %d to 0 by %s", old, actor)
+	writeCount(w, 0)
+}
+
+func handleAdminSetCount(w http.ResponseWriter, r *http.Request, actor AdminActor) {
+	var req SetCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Count == nil || *req.Count < 0 {
+		http.Error(w, "count must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	old, err := adminStore.SetCount(r.Context(), "set", actor, *req.Count)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("PUT /admin/count - Database error: %v", err)
+		return
+	}
+	store.Publish(*req.Count)
+
+	log.Printf("PUT /admin/count - Counter set from %d to %d by %s", old, *req.Count, actor)
+	writeCount(w, *req.Count)
+}
+
+func handleAdminSnapshot(w http.ResponseWriter, r *http.Request, actor AdminActor) {
+	snapshot := Snapshot{TakenAt: time.Now().UTC()}
+	var err error
+	snapshot.Count, err = adminStore.Snapshot(r.Context(), actor)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("GET /admin/snapshot - Database error: %v", err)
+		return
+	}
+
+	log.Printf("GET /admin/snapshot - Snapshot of count %d taken by %s", snapshot.Count, actor)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+func handleAdminRestore(w http.ResponseWriter, r *http.Request, actor AdminActor) {
+	var snapshot Snapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		http.Error(w, "Invalid snapshot", http.StatusBadRequest)
+		return
+	}
+
+	if snapshot.Count < 0 {
+		http.Error(w, "Snapshot count must be non-negative", http.StatusBadRequest)
+		return
+	}
+
+	old, err := adminStore.SetCount(r.Context(), "restore", actor, snapshot.Count)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /admin/restore - Database error: %v", err)
+		return
+	}
+	store.Publish(snapshot.Count)
+
+	log.Printf("POST /admin/restore - Counter restored from %d to %d (snapshot taken %s) by %s",
+		old, snapshot.Count, snapshot.TakenAt.Format(time.RFC3339), actor)
+	writeCount(w, snapshot.Count)
+}
+
+func writeCount(w http.ResponseWriter, count int) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"count": count})
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseAdminTokens(t *testing.T) {
+	tokens, err := parseAdminTokens(" alice:a-token , bob:b-token,", "legacy-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a-token": "alice", "b-token": "bob", "legacy-token": "admin"}
+	if len(tokens) != len(want) {
+		t.Fatalf("tokens = %v, want %v", tokens, want)
+	}
+	for token, name := range want {
+		if tokens[token] != name {
+			t.Errorf("%s belongs to %q, want %q", token, tokens[token], name)
+		}
+	}
+
+	for _, list := range []string{"alice", "alice:", ":a-token", "alice:same,bob:same"} {
+		_, err := parseAdminTokens(list, "")
+		if err == nil {
+			t.Errorf("%q accepted", list)
+		} else if strings.Contains(err.Error(), "a-token") || strings.Contains(err.Error(), "same") {
+			t.Errorf("%q: error %q reveals a token", list, err)
+		}
+	}
+}
+
+func TestRequireAdminDerivesActorFromToken(t *testing.T) {
+	old := adminTokens
+	adminTokens = map[string]string{"a-token": "alice", "b-token": "bob"}
+	t.Cleanup(func() { adminTokens = old })
+
+	var got *AdminActor
+	handler := requireAdmin(http.MethodPost, func(w http.ResponseWriter, r *http.Request, actor AdminActor) {
+		got = &actor
+	})
+	call := func(token, claimed string) int {
+		got = nil
+		r := httptest.NewRequest(http.MethodPost, "/admin/reset", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if claimed != "" {
+			r.Header.Set("X-Admin-Actor", claimed)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	// Bob claiming to be alice is still recorded as bob
+	if code := call("b-token", "alice"); code != http.StatusOK || got == nil {
+		t.Fatalf("status %d, want the handler called", code)
+	}
+	if got.Name != "bob" || got.ClaimedName != "alice" {
+		t.Errorf("actor = %+v, want bob claiming alice", got)
+	}
+	if got.TokenFingerprint != tokenFingerprint("b-token") || strings.Contains(got.TokenFingerprint, "b-token") {
+		t.Errorf("fingerprint = %q", got.TokenFingerprint)
+	}
+	if s := got.String(); !strings.HasPrefix(s, "bob@") || !strings.Contains(s, `claimed "alice"`) {
+		t.Errorf("actor logged as %q", s)
+	}
+
+	if call("a-token", ""); got == nil || got.Name != "alice" || got.ClaimedName != "" {
+		t.Errorf("actor = %+v, want alice", got)
+	}
+	if tokenFingerprint("a-token") == tokenFingerprint("b-token") {
+		t.Error("different tokens have the same fingerprint")
+	}
+
+	for _, token := range []string{"", "c-token", "a-toke"} {
+		if code := call(token, "alice"); code != http.StatusUnauthorized || got != nil {
+			t.Errorf("token %q: status %d, want 401", token, code)
+		}
+	}
+}
+
+func TestRequireAdminDisabledWithoutTokens(t *testing.T) {
+	old := adminTokens
+	adminTokens = nil
+	t.Cleanup(func() { adminTokens = old })
+
+	handler := requireAdmin(http.MethodPost, func(w http.ResponseWriter, r *http.Request, actor AdminActor) {
+		t.Error("handler called")
+	})
+	r := httptest.NewRequest(http.MethodPost, "/admin/reset", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404", w.Code)
+	}
+}
+
+// memoryAdminStore is an AdminStore over an in-memory counter, recording
+// the audit entries the Postgres store would insert.
+type memoryAdminStore struct {
+	mu    sync.Mutex
+	count int
+	audit []AuditEntry
+	err   error
+}
+
+func (s *memoryAdminStore) SetCount(ctx context.Context, action string, actor AdminActor, count int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	old := s.count
+	s.count = count
+	s.audit = append(s.audit, AuditEntry{action, actor, &old, &count})
+	return old, nil
+}
+
+func (s *memoryAdminStore) Snapshot(ctx context.Context, actor AdminActor) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	count := s.count
+	s.audit = append(s.audit, AuditEntry{"snapshot", actor, &count, nil})
+	return count, nil
+}
+
+// useMemoryAdminStore enables the admin API for alice and bob with an
+// in-memory store until the test ends.
+func useMemoryAdminStore(t *testing.T, count int) *memoryAdminStore {
+	t.Helper()
+	s := &memoryAdminStore{count: count}
+	oldTokens, oldAdminStore, oldStore := adminTokens, adminStore, store
+	adminTokens = map[string]string{"a-token": "alice", "b-token": "bob"}
+	adminStore, store = s, NewCounterStore(nil)
+	t.Cleanup(func() { adminTokens, adminStore, store = oldTokens, oldAdminStore, oldStore })
+	return s
+}
+
+// adminCall calls an admin endpoint with the token, the X-Admin-Actor
+// header if claimed is set, and the body.
+func adminCall(method, token, claimed, body string, next func(http.ResponseWriter, *http.Request, AdminActor)) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/admin", strings.NewReader(body))
+	r.RemoteAddr = "10.0.0.7:51234"
+	r.Header.Set("Authorization", "Bearer "+token)
+	if claimed != "" {
+		r.Header.Set("X-Admin-Actor", claimed)
+	}
+	w := httptest.NewRecorder()
+	requireAdmin(method, next)(w, r)
+	return w
+}
+
+func intPtr(n int) *int { return &n }
+
+func sameCount(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func TestAdminActionsAreAudited(t *testing.T) {
+	s := useMemoryAdminStore(t, 7)
+	watch, stop := store.Watch()
+	defer stop()
+
+	// Take a snapshot, change the counter twice and restore the snapshot
+	w := adminCall(http.MethodGet, "a-token", "", "", handleAdminSnapshot)
+	if w.Code != http.StatusOK {
+		t.Fatalf("snapshot: status %d", w.Code)
+	}
+	var snapshot Snapshot
+	if err := json.NewDecoder(w.Body).Decode(&snapshot); err != nil || snapshot.Count != 7 || snapshot.TakenAt.IsZero() {
+		t.Fatalf("snapshot = %+v, %v", snapshot, err)
+	}
+	snapshotJSON, _ := json.Marshal(snapshot)
+
+	steps := []struct {
+		method, token, claimed, body string
+		handler                      func(http.ResponseWriter, *http.Request, AdminActor)
+		want                         int
+	}{
+		{http.MethodPut, "b-token", "", `{"count": 42}`, handleAdminSetCount, 42},
+		{http.MethodPost, "b-token", "alice", "", handleAdminReset, 0},
+		{http.MethodPost, "a-token", "alice", string(snapshotJSON), handleAdminRestore, 7},
+	}
+	for _, step := range steps {
+		w := adminCall(step.method, step.token, step.claimed, step.body, step.handler)
+		var resp map[string]int
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusOK || resp["count"] != step.want {
+			t.Fatalf("%s %s: status %d, count %d, want %d", step.method, step.body, w.Code, resp["count"], step.want)
+		}
+		if published := <-watch; published != step.want {
+			t.Errorf("published %d, want %d", published, step.want)
+		}
+	}
+
+	want := []AuditEntry{
+		{"snapshot", AdminActor{Name: "alice"}, intPtr(7), nil},
+		{"set", AdminActor{Name: "bob"}, intPtr(7), intPtr(42)},
+		// Bob claiming to be alice is recorded as bob
+		{"reset", AdminActor{Name: "bob", ClaimedName: "alice"}, intPtr(42), intPtr(0)},
+		{"restore", AdminActor{Name: "alice", ClaimedName: "alice"}, intPtr(0), intPtr(7)},
+	}
+	if len(s.audit) != len(want) {
+		t.Fatalf("audit log has %d entries, want %d", len(s.audit), len(want))
+	}
+	for i, got := range s.audit {
+		w := want[i]
+		fingerprint := map[string]string{"alice": tokenFingerprint("a-token"), "bob": tokenFingerprint("b-token")}[w.Actor.Name]
+		if got.Action != w.Action || got.Actor.Name != w.Actor.Name || got.Actor.ClaimedName != w.Actor.ClaimedName ||
+			got.Actor.TokenFingerprint != fingerprint || got.Actor.RemoteAddr != "10.0.0.7:51234" ||
+			!sameCount(got.OldCount, w.OldCount) || !sameCount(got.NewCount, w.NewCount) {
+			t.Errorf("audit entry %d = %+v, want %+v by token %s", i, got, w, fingerprint)
+		}
+	}
+}
+
+func TestAdminAuditRow(t *testing.T) {
+	values := auditValues(AuditEntry{
+		Action:   "reset",
+		Actor:    AdminActor{Name: "bob", ClaimedName: "alice", TokenFingerprint: "0123456789ab", RemoteAddr: "10.0.0.7:51234"},
+		OldCount: intPtr(42),
+		NewCount: intPtr(0),
+	})
+	if values[0] != "reset" || values[1] != "bob@10.0.0.7:51234" || *values[2].(*string) != "alice" || values[3] != "0123456789ab" {
+		t.Errorf("audit row = %v", values)
+	}
+
+	// Without X-Admin-Actor, claimed_actor is NULL
+	values = auditValues(AuditEntry{Action: "snapshot", Actor: AdminActor{Name: "alice"}, OldCount: intPtr(1)})
+	if values[2].(*string) != nil || values[5].(*int) != nil {
+		t.Errorf("audit row = %v, want NULL claimed_actor and new_count", values)
+	}
+}
+
+func TestAdminRejectedRequestsAreNotAudited(t *testing.T) {
+	s := useMemoryAdminStore(t, 7)
+
+	for _, tt := range []struct {
+		method, token, body string
+		handler             func(http.ResponseWriter, *http.Request, AdminActor)
+		want                int
+	}{
+		{http.MethodPut, "c-token", `{"count": 1}`, handleAdminSetCount, http.StatusUnauthorized},
+		{http.MethodPut, "a-token", `{"count": -1}`, handleAdminSetCount, http.StatusBadRequest},
+		{http.MethodPut, "a-token", `{}`, handleAdminSetCount, http.StatusBadRequest},
+		{http.MethodPost, "a-token", `{"count": -5}`, handleAdminRestore, http.StatusBadRequest},
+		{http.MethodPost, "a-token", `not json`, handleAdminRestore, http.StatusBadRequest},
+	} {
+		if w := adminCall(tt.method, tt.token, "", tt.body, tt.handler); w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.token, tt.body, w.Code, tt.want)
+		}
+	}
+	if len(s.audit) != 0 || s.count != 7 {
+		t.Errorf("count %d with audit log %+v, want 7 and no entries", s.count, s.audit)
+	}
+
+	// A failed transaction is reported and nothing is published
+	s.err = errors.New("connection reset")
+	watch, stop := store.Watch()
+	defer stop()
+	if w := adminCall(http.MethodPost, "a-token", "", "", handleAdminReset); w.Code != http.StatusInternalServerError {
+		t.Errorf("reset with a failing store: status %d, want 500", w.Code)
+	}
+	if w := adminCall(http.MethodGet, "a-token", "", "", handleAdminSnapshot); w.Code != http.StatusInternalServerError {
+		t.Errorf("snapshot with a failing store: status %d, want 500", w.Code)
+	}
+	select {
+	case count := <-watch:
+		t.Errorf("published %d after a failed reset", count)
+	default:
+	}
+}
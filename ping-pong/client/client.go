@@ -0,0 +1,97 @@
+// Package client is a typed gRPC client for the ping-pong service.
+//
+//	c, err := client.Dial("ping-pong-svc:50051")
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	count, err := c.Get(ctx)
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"ping-pong/pingpongpb"
+)
+
+// Update is a counter value received from Watch.
+type Update struct {
+	Count      int64
+	ObservedAt time.Time
+}
+
+type Client struct {
+	conn *grpc.ClientConn
+	pb   pingpongpb.PingPongClient
+}
+
+// Dial creates a client for the ping-pong gRPC service at target. Without
+// options the connection uses plaintext, which matches in-cluster traffic.
+// The connection is established lazily on the first call.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn, pb: pingpongpb.NewPingPongClient(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Get returns the current counter value.
+func (c *Client) Get(ctx context.Context) (int64, error) {
+	resp, err := c.pb.Get(ctx, &pingpongpb.GetRequest{})
+	if err != nil {
+		return 0, err
+	}
+	return resp.GetCount(), nil
+}
+
+// Increment adds one to the counter and returns the value before the
+// increment, the same number the HTTP endpoint prints as "pong N".
+func (c *Client) Increment(ctx context.Context) (int64, error) {
+	resp, err := c.pb.Increment(ctx, &pingpongpb.IncrementRequest{})
+	if err != nil {
+		return 0, err
+	}
+	return resp.GetPong(), nil
+}
+
+// Watch calls fn with the current value and then every change until ctx is
+// cancelled, the stream fails or fn returns an error. It returns nil when
+// ctx is cancelled.
+func (c *Client) Watch(ctx context.Context, fn func(Update) error) error {
+	stream, err := c.pb.Watch(ctx, &pingpongpb.WatchRequest{})
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		update := Update{Count: msg.GetCount(), ObservedAt: msg.GetObservedAt().AsTime()}
+		if err := fn(update); err != nil {
+			return err
+		}
+	}
+}
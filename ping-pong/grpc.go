@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"ping-pong/pingpongpb"
+)
+
+// watchPollInterval bounds how long Watch streams take to notice changes
+// made by other replicas, which are not published to this process.
+const watchPollInterval = 2 * time.Second
+
+type pingPongServer struct {
+	pingpongpb.UnimplementedPingPongServer
+	store *CounterStore
+}
+
+func (s *pingPongServer) Increment(ctx context.Context, _ *pingpongpb.IncrementRequest) (*pingpongpb.IncrementResponse, error) {
+	pong, err := s.store.Increment(ctx)
+	if err != nil {
+		log.Printf("gRPC Increment - Error incrementing counter: %v", err)
+		return nil, status.Error(codes.Unavailable, "database error")
+	}
+	return &pingpongpb.IncrementResponse{Pong: int64(pong), Count: int64(pong) + 1}, nil
+}
+
+func (s *pingPongServer) Get(ctx context.Context, _ *pingpongpb.GetRequest) (*pingpongpb.GetResponse, error) {
+	count, err := s.store.Get(ctx)
+	if err != nil {
+		log.Printf("gRPC Get - Error getting counter: %v", err)
+		return nil, status.Error(codes.Unavailable, "database error")
+	}
+	return &pingpongpb.GetResponse{Count: int64(count)}, nil
+}
+
+func (s *pingPongServer) Watch(_ *pingpongpb.WatchRequest, stream pingpongpb.PingPong_WatchServer) error {
+	ctx := stream.Context()
+
+	updates, stop := s.store.Watch()
+	defer stop()
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	last := -1
+	send := func(count int) error {
+		if count == last {
+			return nil
+		}
+		last = count
+		return stream.Send(&pingpongpb.CountUpdate{
+			Count:      int64(count),
+			ObservedAt: timestamppb.Now(),
+		})
+	}
+
+	count, err := s.store.Get(ctx)
+	if err != nil {
+		return status.Error(codes.Unavailable, "database error")
+	}
+	if err := send(count); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case count := <-updates:
+			if err := send(count); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			count, err := s.store.Get(ctx)
+			if err != nil {
+				log.Printf("gRPC Watch - Error polling counter: %v", err)
+				continue
+			}
+			if err := send(count); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// startGRPCServer serves the PingPong service together with the standard
+// health and reflection services on the given port.
+func startGRPCServer(port string, store *CounterStore) {
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("Failed to listen on gRPC port %s: %v", port, err)
+	}
+
+	srv := grpc.NewServer()
+	pingpongpb.RegisterPingPongServer(srv, &pingPongServer{store: store})
+
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthSrv)
+	go watchDatabaseHealth(healthSrv)
+
+	reflection.Register(srv)
+
+	fmt.Printf("gRPC server started on port %s\n", port)
+	if err := srv.Serve(lis); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// watchDatabaseHealth reports the service as NOT_SERVING while the database
+// cannot be reached.
+func watchDatabaseHealth(healthSrv *health.Server) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		state := healthpb.HealthCheckResponse_SERVING
+		if err := db.Ping(); err != nil {
+			state = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		healthSrv.SetServingStatus("", state)
+		healthSrv.SetServingStatus(pingpongpb.PingPong_ServiceDesc.ServiceName, state)
+
+		<-ticker.C
+	}
+}
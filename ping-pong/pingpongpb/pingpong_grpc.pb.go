@@ -0,0 +1,214 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             v5.27.1
+// source: pingpong.proto
+
+package pingpongpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	PingPong_Increment_FullMethodName = "/pingpong.v1.PingPong/Increment"
+	PingPong_Get_FullMethodName       = "/pingpong.v1.PingPong/Get"
+	PingPong_Watch_FullMethodName     = "/pingpong.v1.PingPong/Watch"
+)
+
+// PingPongClient is the client API for PingPong service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PingPongClient interface {
+	Increment(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error)
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (PingPong_WatchClient, error)
+}
+
+type pingPongClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPingPongClient(cc grpc.ClientConnInterface) PingPongClient {
+	return &pingPongClient{cc}
+}
+
+func (c *pingPongClient) Increment(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IncrementResponse)
+	err := c.cc.Invoke(ctx, PingPong_Increment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pingPongClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, PingPong_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pingPongClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (PingPong_WatchClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PingPong_ServiceDesc.Streams[0], PingPong_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pingPongWatchClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PingPong_WatchClient interface {
+	Recv() (*CountUpdate, error)
+	grpc.ClientStream
+}
+
+type pingPongWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *pingPongWatchClient) Recv() (*CountUpdate, error) {
+	m := new(CountUpdate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PingPongServer is the server API for PingPong service.
+// All implementations must embed UnimplementedPingPongServer
+// for forward compatibility
+type PingPongServer interface {
+	Increment(context.Context, *IncrementRequest) (*IncrementResponse, error)
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	Watch(*WatchRequest, PingPong_WatchServer) error
+	mustEmbedUnimplementedPingPongServer()
+}
+
+// UnimplementedPingPongServer must be embedded to have forward compatible implementations.
+type UnimplementedPingPongServer struct {
+}
+
+func (UnimplementedPingPongServer) Increment(context.Context, *IncrementRequest) (*IncrementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Increment not implemented")
+}
+func (UnimplementedPingPongServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedPingPongServer) Watch(*WatchRequest, PingPong_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedPingPongServer) mustEmbedUnimplementedPingPongServer() {}
+
+// UnsafePingPongServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PingPongServer will
+// result in compilation errors.
+type UnsafePingPongServer interface {
+	mustEmbedUnimplementedPingPongServer()
+}
+
+func RegisterPingPongServer(s grpc.ServiceRegistrar, srv PingPongServer) {
+	s.RegisterService(&PingPong_ServiceDesc, srv)
+}
+
+func _PingPong_Increment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrementRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PingPongServer).Increment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PingPong_Increment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PingPongServer).Increment(ctx, req.(*IncrementRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PingPong_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PingPongServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PingPong_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PingPongServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PingPong_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PingPongServer).Watch(m, &pingPongWatchServer{ServerStream: stream})
+}
+
+type PingPong_WatchServer interface {
+	Send(*CountUpdate) error
+	grpc.ServerStream
+}
+
+type pingPongWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *pingPongWatchServer) Send(m *CountUpdate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// PingPong_ServiceDesc is the grpc.ServiceDesc for PingPong service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PingPong_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pingpong.v1.PingPong",
+	HandlerType: (*PingPongServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Increment",
+			Handler:    _PingPong_Increment_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _PingPong_Get_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _PingPong_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pingpong.proto",
+}
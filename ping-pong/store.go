@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// CounterStore wraps the counter table and notifies watchers of every change
+// made through this process. Both the HTTP and gRPC handlers use it.
+type CounterStore struct {
+	db *sql.DB
+
+	mu       sync.Mutex
+	watchers map[chan int]struct{}
+}
+
+func NewCounterStore(db *sql.DB) *CounterStore {
+	return &CounterStore{db: db, watchers: make(map[chan int]struct{})}
+}
+
+func (s *CounterStore) Get(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT count FROM counter WHERE id = 1").Scan(&count)
+	return count, err
+}
+
+// Increment adds one to the counter and returns the value before the increment.
+func (s *CounterStore) Increment(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE counter SET count = count + 1 WHERE id = 1 RETURNING count
+	`).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	s.Publish(count)
+	return count - 1, nil // Return the value before increment
+}
+
+// Watch registers a watcher channel. The returned function must be called to
+// unregister it. Slow watchers miss intermediate values rather than blocking
+// writers.
+func (s *CounterStore) Watch() (<-chan int, func()) {
+	ch := make(chan int, 1)
+
+	s.mu.Lock()
+	s.watchers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.watchers, ch)
+		s.mu.Unlock()
+	}
+}
+
+// Publish sends count to all watchers without blocking.
+func (s *CounterStore) Publish(count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.watchers {
+		select {
+		case ch <- count:
+		default:
+			// Drop the stale value so the watcher sees the latest one
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- count
+		}
+	}
+}
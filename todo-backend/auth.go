@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	bcryptCost          = 12
+	minPasswordLength   = 8
+	maxPasswordLength   = 72 // bcrypt ignores anything longer
+	minSigningKeyLength = 32
+	maxTokenNameLength  = 100
+
+	// API tokens start with this, so they can be told apart from JWTs and
+	// found by secret scanners
+	apiTokenPrefix = "tdk_"
+
+	sessionIssuer = "todo-backend"
+
+	publishedExampleSigningKey = "example-signing-key-replace-with-openssl-rand-base64-48"
+)
+
+var (
+	userStore UserStore
+
+	// signingKey signs session JWTs with HMAC-SHA256. It is read from the
+	// file in JWT_SIGNING_KEY_FILE, mounted from a Secret.
+	signingKey []byte
+
+	sessionTTL        = 24 * time.Hour
+	allowRegistration = false
+
+	// adminUsername is created at startup with the password in
+	// ADMIN_PASSWORD_FILE, and adopts the lists and todos created before
+	// accounts existed. Empty means nobody adopts them.
+	adminUsername string
+
+	// allowedOrigins may call the API from a browser. Empty means same
+	// origin only; "*" allows any origin.
+	allowedOrigins []string
+)
+
+// dummyPasswordHash is compared against when a username does not exist, so
+// logins take as long for unknown users as for wrong passwords.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcryptCost)
+
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      User      `json:"user"`
+}
+
+type CreateAPITokenRequest struct {
+	Name string `json:"name"`
+}
+
+type sessionClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Username  string `json:"name"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// loadSigningKey reads the JWT signing key. Surrounding whitespace, such as
+// a trailing newline, is ignored.
+func loadSigningKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := []byte(strings.TrimSpace(string(data)))
+	if len(key) < minSigningKeyLength {
+		return nil, fmt.Errorf("%s: signing key must be at least %d bytes", path, minSigningKeyLength)
+	}
+	// Once committed to the root kustomization.yaml, so it is public
+	if string(key) == publishedExampleSigningKey {
+		return nil, fmt.Errorf("%s: signing key is the published example key; generate one with openssl rand -base64 48", path)
+	}
+	return key, nil
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// issueSessionToken returns a JWT for the user, valid for sessionTTL.
+func issueSessionToken(user User, now time.Time) (string, time.Time) {
+	expires := now.Add(sessionTTL)
+	claims, _ := json.Marshal(sessionClaims{
+		Issuer:    sessionIssuer,
+		Subject:   user.ID,
+		Username:  user.Username,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return unsigned + "." + signJWT(unsigned), expires
+}
+
+func signJWT(unsigned string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySessionToken checks the signature, issuer and expiry of a JWT from
+// issueSessionToken. Only HS256 is accepted, whatever the header says.
+func verifySessionToken(token string, now time.Time) (sessionClaims, error) {
+	var claims sessionClaims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("malformed token")
+	}
+	if parts[0] != jwtHeader {
+		return claims, errors.New("unsupported token header")
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(signJWT(parts[0]+"."+parts[1]))) {
+		return claims, errors.New("invalid signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if claims.Issuer != sessionIssuer || claims.Subject == "" {
+		return claims, errors.New("invalid claims")
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, errors.New("token expired")
+	}
+	return claims, nil
+}
+
+// newAPIToken returns a random token and the hash stored for it.
+func newAPIToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashAPIToken(token), nil
+}
+
+// hashAPIToken is a plain SHA-256: the tokens are random, so they need no
+// salt or slow hash, and lookups by hash stay fast.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticate returns the user behind the request's bearer token, either a
+// session JWT, an ID token from the OIDC provider or an API token, and
+// whether it was a session. ID tokens count as sessions.
+func authenticate(r *http.Request) (User, bool, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return User{}, false, errors.New("missing bearer token")
+	}
+
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		user, err := userStore.APITokenUser(r.Context(), hashAPIToken(token))
+		return user, false, err
+	}
+
+	if oidcVerifier != nil && isOIDCToken(token) {
+		identity, err := oidcVerifier.Verify(r.Context(), token, time.Now())
+		if err != nil {
+			return User{}, false, fmt.Errorf("OIDC token: %w", err)
+		}
+		user, err := userStore.OIDCUser(r.Context(), identity.Issuer, identity.Subject, identity.Username)
+		return user, true, err
+	}
+
+	claims, err := verifySessionToken(token, time.Now())
+	if err != nil {
+		return User{}, false, err
+	}
+	// The user may have been deleted since the token was issued
+	user, err := userStore.UserByID(r.Context(), claims.Subject)
+	return user, true, err
+}
+
+// requireUser handles CORS and preflight requests, then calls next with the
+// authenticated user. With sessionOnly, API tokens are not accepted.
+func requireUser(sessionOnly bool, next func(w http.ResponseWriter, r *http.Request, user User)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, r)
+
+		// Handle preflight request
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		user, session, err := authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="todo-backend"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Printf("%s %s - Unauthorized request from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			return
+		}
+		if sessionOnly && !session {
+			http.Error(w, "This endpoint needs a login session, not an API token", http.StatusForbidden)
+			log.Printf("%s %s - REJECTED: API token used by %s", r.Method, r.URL.Path, user.Username)
+			return
+		}
+
+		next(w, r, user)
+	}
+}
+
+// setCORSHeaders allows browsers on allowedOrigins to call the API.
+func setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	w.Header().Add("Vary", "Origin")
+	if !slices.Contains(allowedOrigins, "*") && !slices.Contains(allowedOrigins, origin) {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key")
+}
+
+// publicHandler handles CORS and preflight requests for endpoints that
+// need no login.
+func publicHandler(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, r)
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func registerAuthHandlers() {
+	http.HandleFunc("/auth/register", publicHandler("POST", handleRegister))
+	http.HandleFunc("/auth/login", publicHandler("POST", handleLogin))
+	http.HandleFunc("/auth/me", requireUser(false, handleMe))
+	http.HandleFunc("/auth/tokens", requireUser(true, handleAPITokens))
+	http.HandleFunc("/auth/tokens/", requireUser(true, handleAPIToken))
+}
+
+func handleRegister(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST /auth/register - Request from %s", r.RemoteAddr)
+
+	var creds Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	creds.Username = strings.ToLower(strings.TrimSpace(creds.Username))
+
+	if !allowRegistration {
+		log.Printf("POST /auth/register - REJECTED: registration is disabled")
+		http.Error(w, "Registration is disabled", http.StatusForbidden)
+		return
+	}
+	// The admin account is only created by bootstrapAdmin
+	if adminUsername != "" && creds.Username == adminUsername {
+		log.Printf("POST /auth/register - REJECTED: %s is the admin account", creds.Username)
+		http.Error(w, "Username is taken", http.StatusConflict)
+		return
+	}
+
+	if err := validateCredentials(creds); err != nil {
+		log.Printf("POST /auth/register - REJECTED: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcryptCost)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Printf("POST /auth/register - Error hashing password: %v", err)
+		return
+	}
+
+	user, err := userStore.CreateUser(r.Context(), creds.Username, string(hash), false)
+	if errors.Is(err, errUsernameTaken) {
+		log.Printf("POST /auth/register - REJECTED: username %s is taken", creds.Username)
+		http.Error(w, "Username is taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /auth/register - Database error creating user: %v", err)
+		return
+	}
+
+	log.Printf("POST /auth/register - SUCCESS: Created user %s - %s", user.ID, user.Username)
+	writeJSON(w, http.StatusCreated, user)
+}
+
+// bootstrapAdmin creates the adminUsername account with the password in
+// passwordFile, unless it exists. The new account adopts the lists and todos
+// that have no owner. The password is only used the first time.
+func bootstrapAdmin(ctx context.Context, passwordFile string) error {
+	if _, _, err := userStore.UserByUsername(ctx, adminUsername); err == nil {
+		return nil
+	} else if !errors.Is(err, errUserNotFound) {
+		return err
+	}
+
+	data, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return err
+	}
+	creds := Credentials{Username: adminUsername, Password: strings.TrimSpace(string(data))}
+	if err := validateCredentials(creds); err != nil {
+		return fmt.Errorf("%s: %w", passwordFile, err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcryptCost)
+	if err != nil {
+		return err
+	}
+	user, err := userStore.CreateUser(ctx, creds.Username, string(hash), true)
+	if errors.Is(err, errUsernameTaken) {
+		// Created by another replica starting at the same time
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Created admin account %s - %s", user.ID, user.Username)
+	return nil
+}
+
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST /auth/login - Request from %s", r.RemoteAddr)
+
+	var creds Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	creds.Username = strings.ToLower(strings.TrimSpace(creds.Username))
+
+	user, hash, err := userStore.UserByUsername(r.Context(), creds.Username)
+	if err != nil && !errors.Is(err, errUserNotFound) {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /auth/login - Database error reading user: %v", err)
+		return
+	}
+	if errors.Is(err, errUserNotFound) {
+		hash = string(dummyPasswordHash)
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(creds.Password)) != nil || err != nil {
+		log.Printf("POST /auth/login - REJECTED: wrong username or password for %q", creds.Username)
+		http.Error(w, "Wrong username or password", http.StatusUnauthorized)
+		return
+	}
+
+	token, expires := issueSessionToken(user, time.Now())
+	log.Printf("POST /auth/login - SUCCESS: %s logged in", user.Username)
+	writeJSON(w, http.StatusOK, LoginResponse{Token: token, ExpiresAt: expires, User: user})
+}
+
+func handleMe(w http.ResponseWriter, r *http.Request, user User) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// handleAPITokens serves GET and POST /auth/tokens. The token itself is
+// only in the POST response.
+func handleAPITokens(w http.ResponseWriter, r *http.Request, user User) {
+	switch r.Method {
+	case "GET":
+		tokens, err := userStore.APITokens(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("GET /auth/tokens - Database error listing tokens: %v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tokens)
+
+	case "POST":
+		var req CreateAPITokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > maxTokenNameLength {
+			http.Error(w, fmt.Sprintf("Token name is required and must be %d characters or less", maxTokenNameLength), http.StatusBadRequest)
+			return
+		}
+
+		secret, hash, err := newAPIToken()
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			log.Printf("POST /auth/tokens - Error generating token: %v", err)
+			return
+		}
+		token, err := userStore.CreateAPIToken(r.Context(), user.ID, req.Name, hash)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("POST /auth/tokens - Database error creating token: %v", err)
+			return
+		}
+		token.Token = secret
+
+		log.Printf("POST /auth/tokens - SUCCESS: %s created API token %s - %s", user.Username, token.ID, token.Name)
+		writeJSON(w, http.StatusCreated, token)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAPIToken serves DELETE /auth/tokens/{id}, which revokes the token.
+func handleAPIToken(w http.ResponseWriter, r *http.Request, user User) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/auth/tokens/")
+	err := userStore.DeleteAPIToken(r.Context(), user.ID, id)
+	if errors.Is(err, errTokenNotFound) {
+		http.Error(w, "API token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("DELETE /auth/tokens/%s - Database error revoking token: %v", id, err)
+		return
+	}
+
+	log.Printf("DELETE /auth/tokens/%s - SUCCESS: %s revoked API token", id, user.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateCredentials checks a new account's username and password.
+func validateCredentials(creds Credentials) error {
+	if len(creds.Username) < 3 || len(creds.Username) > 32 {
+		return errors.New("Username must be 3 to 32 characters")
+	}
+	for _, c := range creds.Username {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' && c != '.' {
+			return errors.New("Username may only contain letters a-z, digits, -, _ and .")
+		}
+	}
+	if len(creds.Password) < minPasswordLength || len(creds.Password) > maxPasswordLength {
+		return fmt.Errorf("Password must be %d to %d bytes", minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
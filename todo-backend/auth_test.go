@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryUserStore is a UserStore in maps, for testing the authentication
+// code without a database.
+type memoryUserStore struct {
+	mu     sync.Mutex
+	users  map[string]*memoryUser
+	tokens map[string]*memoryToken // by hash
+	// orphansAdoptedBy is the ID of the user created with adoptOrphans
+	orphansAdoptedBy string
+}
+
+type memoryUser struct {
+	User
+	passwordHash string
+	oidcIdentity string
+}
+
+type memoryToken struct {
+	APIToken
+	userID string
+}
+
+func newMemoryUserStore() *memoryUserStore {
+	return &memoryUserStore{users: make(map[string]*memoryUser), tokens: make(map[string]*memoryToken)}
+}
+
+func (s *memoryUserStore) CreateUser(ctx context.Context, username, passwordHash string, adoptOrphans bool) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, err := s.createUser(username, passwordHash, "")
+	if err == nil && adoptOrphans {
+		s.orphansAdoptedBy = user.ID
+	}
+	return user, err
+}
+
+func (s *memoryUserStore) createUser(username, passwordHash, identity string) (User, error) {
+	for _, u := range s.users {
+		if u.Username == username {
+			return User{}, errUsernameTaken
+		}
+	}
+	user := User{ID: uuid.New().String(), Username: username, CreatedAt: time.Now()}
+	s.users[user.ID] = &memoryUser{User: user, passwordHash: passwordHash, oidcIdentity: identity}
+	return user, nil
+}
+
+func (s *memoryUserStore) UserByUsername(ctx context.Context, username string) (User, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == username {
+			return u.User, u.passwordHash, nil
+		}
+	}
+	return User{}, "", errUserNotFound
+}
+
+func (s *memoryUserStore) UserByID(ctx context.Context, id string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		return u.User, nil
+	}
+	return User{}, errUserNotFound
+}
+
+func (s *memoryUserStore) OIDCUser(ctx context.Context, issuer, subject, username string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	identity := issuer + " " + subject
+	for _, u := range s.users {
+		if u.oidcIdentity == identity {
+			return u.User, nil
+		}
+	}
+	return s.createUser(username, "", identity)
+}
+
+func (s *memoryUserStore) CreateAPIToken(ctx context.Context, userID, name, tokenHash string) (APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := APIToken{ID: uuid.New().String(), Name: name, CreatedAt: time.Now()}
+	s.tokens[tokenHash] = &memoryToken{APIToken: token, userID: userID}
+	return token, nil
+}
+
+func (s *memoryUserStore) APITokenUser(ctx context.Context, tokenHash string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[tokenHash]
+	if !ok {
+		return User{}, errTokenNotFound
+	}
+	now := time.Now()
+	t.LastUsedAt = &now
+	return s.users[t.userID].User, nil
+}
+
+func (s *memoryUserStore) APITokens(ctx context.Context, userID string) ([]APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := []APIToken{}
+	for _, t := range s.tokens {
+		if t.userID == userID {
+			tokens = append(tokens, t.APIToken)
+		}
+	}
+	return tokens, nil
+}
+
+func (s *memoryUserStore) DeleteAPIToken(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.tokens {
+		if t.ID == id && t.userID == userID {
+			delete(s.tokens, hash)
+			return nil
+		}
+	}
+	return errTokenNotFound
+}
+
+// useMemoryUserStore points the authentication code at an empty in-memory
+// store and a test signing key until the test ends.
+func useMemoryUserStore(t *testing.T) *memoryUserStore {
+	t.Helper()
+	store := newMemoryUserStore()
+	oldStore, oldKey, oldRegistration, oldAdmin := userStore, signingKey, allowRegistration, adminUsername
+	userStore, signingKey, allowRegistration, adminUsername = store, []byte(strings.Repeat("k", minSigningKeyLength)), true, ""
+	t.Cleanup(func() {
+		userStore, signingKey, allowRegistration, adminUsername = oldStore, oldKey, oldRegistration, oldAdmin
+	})
+	return store
+}
+
+// call runs the handler with the request and, if token is set, a bearer
+// token.
+func call(handler http.HandlerFunc, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	useMemoryUserStore(t)
+	register := publicHandler("POST", handleRegister)
+	login := publicHandler("POST", handleLogin)
+
+	w := call(register, "POST", "/auth/register", "", `{"username": " Alice ", "password": "correct horse"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", w.Code, w.Body)
+	}
+	var user User
+	json.NewDecoder(w.Body).Decode(&user)
+	if user.Username != "alice" {
+		t.Errorf("username = %q, want it trimmed and lowercased", user.Username)
+	}
+
+	for _, tt := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"taken username", `{"username": "alice", "password": "another password"}`, http.StatusConflict},
+		{"short username", `{"username": "al", "password": "correct horse"}`, http.StatusBadRequest},
+		{"invalid username", `{"username": "alice/bob", "password": "correct horse"}`, http.StatusBadRequest},
+		{"short password", `{"username": "bob", "password": "short"}`, http.StatusBadRequest},
+		{"invalid body", `{"username":`, http.StatusBadRequest},
+	} {
+		if w := call(register, "POST", "/auth/register", "", tt.body); w.Code != tt.want {
+			t.Errorf("register with %s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	w = call(login, "POST", "/auth/login", "", `{"username": "ALICE", "password": "correct horse"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	var resp LoginResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	claims, err := verifySessionToken(resp.Token, time.Now())
+	if err != nil {
+		t.Fatalf("session token from login: %v", err)
+	}
+	if claims.Subject != user.ID || resp.User.ID != user.ID {
+		t.Errorf("logged in as %s, want %s", claims.Subject, user.ID)
+	}
+
+	for _, body := range []string{
+		`{"username": "alice", "password": "wrong password"}`,
+		`{"username": "nobody", "password": "correct horse"}`,
+	} {
+		if w := call(login, "POST", "/auth/login", "", body); w.Code != http.StatusUnauthorized {
+			t.Errorf("login with %s: status %d, want 401", body, w.Code)
+		}
+	}
+}
+
+func TestRegistrationDisabled(t *testing.T) {
+	useMemoryUserStore(t)
+	allowRegistration = false
+	adminUsername = "admin"
+	register := publicHandler("POST", handleRegister)
+
+	// Nobody can register, including as the admin before it is created
+	for _, username := range []string{"alice", "Admin"} {
+		w := call(register, "POST", "/auth/register", "", `{"username": "`+username+`", "password": "correct horse"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d, want 403", username, w.Code)
+		}
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	store := useMemoryUserStore(t)
+	adminUsername = "admin"
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("correct horse\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Registering first neither takes the admin account nor adopts the
+	// ownerless data
+	register := publicHandler("POST", handleRegister)
+	if w := call(register, "POST", "/auth/register", "", `{"username": "admin", "password": "attacker pass"}`); w.Code != http.StatusConflict {
+		t.Errorf("register as admin: status %d, want 409", w.Code)
+	}
+	if w := call(register, "POST", "/auth/register", "", `{"username": "alice", "password": "correct horse"}`); w.Code != http.StatusCreated {
+		t.Fatalf("alice: status %d: %s", w.Code, w.Body)
+	}
+	if store.orphansAdoptedBy != "" {
+		t.Fatalf("orphans adopted by %q before the admin exists", store.orphansAdoptedBy)
+	}
+
+	if err := bootstrapAdmin(context.Background(), passwordFile); err != nil {
+		t.Fatal(err)
+	}
+	admin, _, err := store.UserByUsername(context.Background(), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.orphansAdoptedBy != admin.ID {
+		t.Errorf("orphans adopted by %q, want the admin %q", store.orphansAdoptedBy, admin.ID)
+	}
+	login := publicHandler("POST", handleLogin)
+	if w := call(login, "POST", "/auth/login", "", `{"username": "admin", "password": "correct horse"}`); w.Code != http.StatusOK {
+		t.Errorf("admin login: status %d, want 200", w.Code)
+	}
+
+	// Later starts leave the account alone, even with another password
+	if err := os.WriteFile(passwordFile, []byte("new password"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bootstrapAdmin(context.Background(), passwordFile); err != nil {
+		t.Fatal(err)
+	}
+	if w := call(login, "POST", "/auth/login", "", `{"username": "admin", "password": "correct horse"}`); w.Code != http.StatusOK {
+		t.Errorf("admin login after restart: status %d, want 200", w.Code)
+	}
+}
+
+func TestBootstrapAdminRejectsBadPasswords(t *testing.T) {
+	store := useMemoryUserStore(t)
+	adminUsername = "admin"
+	dir := t.TempDir()
+	short := filepath.Join(dir, "short")
+	if err := os.WriteFile(short, []byte("short\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{short, filepath.Join(dir, "missing")} {
+		if err := bootstrapAdmin(context.Background(), path); err == nil {
+			t.Errorf("%s: admin created", path)
+		}
+	}
+	if _, _, err := store.UserByUsername(context.Background(), "admin"); err == nil {
+		t.Error("admin account exists")
+	}
+}
+
+func TestSessionTokenExpiry(t *testing.T) {
+	useMemoryUserStore(t)
+	now := time.Now()
+	token, expires := issueSessionToken(User{ID: "user-1", Username: "alice"}, now)
+	if !expires.Equal(now.Add(sessionTTL)) {
+		t.Errorf("expires at %v, want %v", expires, now.Add(sessionTTL))
+	}
+
+	if _, err := verifySessionToken(token, expires.Add(-time.Second)); err != nil {
+		t.Errorf("just before expiry: %v", err)
+	}
+	if _, err := verifySessionToken(token, expires); err == nil || err.Error() != "token expired" {
+		t.Errorf("at expiry: err = %v, want token expired", err)
+	}
+
+	key := signingKey
+	signingKey = []byte(strings.Repeat("x", minSigningKeyLength))
+	otherKey, _ := issueSessionToken(User{ID: "user-1", Username: "alice"}, now)
+	signingKey = key
+
+	parts := strings.Split(token, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	for name, tampered := range map[string]string{
+		"alg none":       none + "." + parts[1] + ".",
+		"other claims":   parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"todo-backend","sub":"user-2","exp":9999999999}`)) + "." + parts[2],
+		"truncated":      parts[0] + "." + parts[1],
+		"other key":      otherKey,
+		"empty":          "",
+		"only the parts": "..",
+	} {
+		if _, err := verifySessionToken(tampered, now); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestAPITokenAuth(t *testing.T) {
+	store := useMemoryUserStore(t)
+	user, _ := store.CreateUser(context.Background(), "alice", "", false)
+	session, _ := issueSessionToken(user, time.Now())
+	tokens := requireUser(true, handleAPITokens)
+	me := requireUser(false, handleMe)
+
+	w := call(tokens, "POST", "/auth/tokens", session, `{"name": "ci"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token: status %d: %s", w.Code, w.Body)
+	}
+	var created APIToken
+	json.NewDecoder(w.Body).Decode(&created)
+	if !strings.HasPrefix(created.Token, apiTokenPrefix) {
+		t.Fatalf("token %q does not start with %s", created.Token, apiTokenPrefix)
+	}
+	if _, ok := store.tokens[hashAPIToken(created.Token)]; !ok {
+		t.Error("the token's hash is not stored")
+	}
+
+	w = call(me, "GET", "/auth/me", created.Token, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("API token: status %d: %s", w.Code, w.Body)
+	}
+	var got User
+	json.NewDecoder(w.Body).Decode(&got)
+	if got.ID != user.ID {
+		t.Errorf("API token authenticated %s, want %s", got.Username, user.Username)
+	}
+
+	// API tokens cannot manage API tokens
+	if w := call(tokens, "GET", "/auth/tokens", created.Token, ""); w.Code != http.StatusForbidden {
+		t.Errorf("listing tokens with an API token: status %d, want 403", w.Code)
+	}
+
+	for name, token := range map[string]string{
+		"unknown API token": apiTokenPrefix + "unknown",
+		"no token":          "",
+	} {
+		if w := call(me, "GET", "/auth/me", token, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", name, w.Code)
+		}
+	}
+
+	if w := call(requireUser(true, handleAPIToken), "DELETE", "/auth/tokens/"+created.ID, session, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: status %d: %s", w.Code, w.Body)
+	}
+	if w := call(me, "GET", "/auth/me", created.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: status %d, want 401", w.Code)
+	}
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	key := strings.Repeat("k", minSigningKeyLength)
+	if got, err := loadSigningKey(write("good", key+"\n")); err != nil || string(got) != key {
+		t.Errorf("loadSigningKey = %q, %v, want the key without the newline", got, err)
+	}
+
+	for name, path := range map[string]string{
+		"missing":   filepath.Join(dir, "missing"),
+		"empty":     write("empty", "\n"),
+		"too short": write("short", strings.Repeat("k", minSigningKeyLength-1)+"\n"),
+		"example":   write("example", publishedExampleSigningKey+"\n"),
+	} {
+		if _, err := loadSigningKey(path); err == nil {
+			t.Errorf("%s key accepted", name)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// todoEventsChannel is the Postgres NOTIFY channel that the todos trigger
+// from migration 8 sends to on every insert, update and delete. Every
+// replica listens on it, so clients get the changes made through any of
+// them, and by anything else writing to the database.
+const todoEventsChannel = "todo_events"
+
+const (
+	// Sent on idle streams, so proxies and load balancers keep them open
+	eventKeepAlive = 25 * time.Second
+
+	// Events a subscriber may fall behind by before it is disconnected
+	eventBuffer = 64
+)
+
+// TodoEvent is sent to the owner of a todo when it is created, updated or
+// deleted. Deleted events only have the ID. Resync means events may have
+// been lost, and the client should fetch the todos again.
+type TodoEvent struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	Todo *Todo  `json:"todo,omitempty"`
+}
+
+// todoNotification is the payload of the trigger's NOTIFY.
+type todoNotification struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+// eventHub fans events out to the streams open on this replica, by user.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan TodoEvent]struct{}
+}
+
+var todoEvents = &eventHub{subscribers: make(map[string]map[chan TodoEvent]struct{})}
+
+func (h *eventHub) subscribe(userID string) chan TodoEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan TodoEvent, eventBuffer)
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan TodoEvent]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe closes ch, unless publish already has.
+func (h *eventHub) unsubscribe(userID string, ch chan TodoEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[userID][ch]; ok {
+		h.remove(userID, ch)
+	}
+}
+
+func (h *eventHub) remove(userID string, ch chan TodoEvent) {
+	delete(h.subscribers[userID], ch)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+	close(ch)
+}
+
+func (h *eventHub) hasSubscribers(userID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[userID]) > 0
+}
+
+// publish sends the event to the user's streams. A stream that has fallen
+// eventBuffer events behind is closed rather than blocking everyone else;
+// its client reconnects and fetches the todos again.
+func (h *eventHub) publish(userID string, event TodoEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("GET /todos/events - Dropping a stream of user %s that fell behind", userID)
+			h.remove(userID, ch)
+		}
+	}
+}
+
+// publishAll sends the event to every stream, e.g. a resync after the
+// database connection was lost.
+func (h *eventHub) publishAll(event TodoEvent) {
+	h.mu.Lock()
+	userIDs := make([]string, 0, len(h.subscribers))
+	for userID := range h.subscribers {
+		userIDs = append(userIDs, userID)
+	}
+	h.mu.Unlock()
+
+	for _, userID := range userIDs {
+		h.publish(userID, event)
+	}
+}
+
+// listenTodoEvents forwards the trigger's notifications to the streams on
+// this replica until the process exits. pq.Listener reconnects by itself;
+// notifications sent while it was disconnected are lost, so the streams
+// are told to resync.
+func listenTodoEvents(dbURL string) {
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Todo events - Listener error: %v", err)
+		}
+	})
+	if err := listener.Listen(todoEventsChannel); err != nil {
+		log.Printf("Todo events - Error listening on %s: %v", todoEventsChannel, err)
+	}
+
+	for {
+		select {
+		case n := <-listener.Notify:
+			handleListenerNotification(n)
+
+		case <-time.After(90 * time.Second):
+			// Notices a dead connection even when nothing changes
+			go listener.Ping()
+		}
+	}
+}
+
+// handleListenerNotification dispatches a notification from the listener,
+// which sends nil after a reconnect.
+func handleListenerNotification(n *pq.Notification) {
+	if n == nil {
+		log.Printf("Todo events - Reconnected to the database, asking streams to resync")
+		todoEvents.publishAll(TodoEvent{Type: "resync"})
+		return
+	}
+	dispatchTodoNotification(n.Extra)
+}
+
+// findEventTodo reads the todo a created or updated event carries.
+var findEventTodo = func(id string) (Todo, error) {
+	return scanTodo(db.QueryRow("SELECT "+todoColumns+" FROM todos WHERE id = $1", id))
+}
+
+func dispatchTodoNotification(payload string) {
+	var n todoNotification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		log.Printf("Todo events - Invalid notification %q: %v", payload, err)
+		return
+	}
+	if n.UserID == "" || !todoEvents.hasSubscribers(n.UserID) {
+		return
+	}
+
+	event := TodoEvent{Type: n.Type, ID: n.ID}
+	if n.Type != "deleted" {
+		// One query per change on each replica, however many streams the
+		// user has open
+		todo, err := findEventTodo(n.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted since; its deleted event follows
+			return
+		}
+		if err != nil {
+			log.Printf("Todo events - Database error reading todo %s: %v", n.ID, err)
+			todoEvents.publish(n.UserID, TodoEvent{Type: "resync"})
+			return
+		}
+		event.Todo = &todo
+	}
+	todoEvents.publish(n.UserID, event)
+}
+
+// handleTodoEvents serves GET /todos/events, a Server-Sent Events stream of
+// the user's todo changes.
+func handleTodoEvents(w http.ResponseWriter, r *http.Request, user User) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("GET /todos/events - %s subscribed from %s", user.Username, r.RemoteAddr)
+	events := todoEvents.subscribe(user.ID)
+	defer todoEvents.unsubscribe(user.ID, events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stops nginx-style proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("GET /todos/events - %s disconnected", user.Username)
+			return
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("GET /todos/events - Error encoding event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// fakeTodos stands in for the todos table when dispatching notifications,
+// and counts the lookups.
+type fakeTodos struct {
+	mu      sync.Mutex
+	todos   map[string]Todo
+	err     error
+	lookups int
+}
+
+func (f *fakeTodos) find(id string) (Todo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	if f.err != nil {
+		return Todo{}, f.err
+	}
+	todo, ok := f.todos[id]
+	if !ok {
+		return Todo{}, sql.ErrNoRows
+	}
+	return todo, nil
+}
+
+func (f *fakeTodos) lookupCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lookups
+}
+
+// useEventHub gives the test its own hub and todos until it ends.
+func useEventHub(t *testing.T) *fakeTodos {
+	t.Helper()
+	todos := &fakeTodos{todos: make(map[string]Todo)}
+	oldHub, oldFind := todoEvents, findEventTodo
+	todoEvents = &eventHub{subscribers: make(map[string]map[chan TodoEvent]struct{})}
+	findEventTodo = todos.find
+	t.Cleanup(func() { todoEvents, findEventTodo = oldHub, oldFind })
+	return todos
+}
+
+// received returns the events waiting on ch, and whether it is still open.
+func received(ch chan TodoEvent) ([]TodoEvent, bool) {
+	var events []TodoEvent
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events, false
+			}
+			events = append(events, event)
+		default:
+			return events, true
+		}
+	}
+}
+
+func expectEvents(t *testing.T, name string, ch chan TodoEvent, want ...TodoEvent) {
+	t.Helper()
+	got, open := received(ch)
+	if !open {
+		t.Errorf("%s: stream closed", name)
+	}
+	if len(got) != len(want) {
+		t.Errorf("%s: got %+v, want %+v", name, got, want)
+		return
+	}
+	for i := range got {
+		if got[i].Type != want[i].Type || got[i].ID != want[i].ID || (got[i].Todo == nil) != (want[i].Todo == nil) ||
+			(got[i].Todo != nil && got[i].Todo.Text != want[i].Todo.Text) {
+			t.Errorf("%s: event %d = %+v, want %+v", name, i, got[i], want[i])
+		}
+	}
+}
+
+func notification(typ, id, userID string) string {
+	return fmt.Sprintf(`{"type": %q, "id": %q, "user_id": %q}`, typ, id, userID)
+}
+
+func TestEventsReachOnlyTheOwner(t *testing.T) {
+	useEventHub(t)
+	laptop, phone := todoEvents.subscribe("alice"), todoEvents.subscribe("alice")
+	bob := todoEvents.subscribe("bob")
+
+	todoEvents.publish("alice", TodoEvent{Type: "deleted", ID: "t1"})
+	expectEvents(t, "alice's laptop", laptop, TodoEvent{Type: "deleted", ID: "t1"})
+	expectEvents(t, "alice's phone", phone, TodoEvent{Type: "deleted", ID: "t1"})
+	expectEvents(t, "bob", bob)
+
+	// Publishing to a user without streams does nothing
+	todoEvents.publish("carol", TodoEvent{Type: "deleted", ID: "t2"})
+	if todoEvents.hasSubscribers("carol") {
+		t.Error("carol has subscribers")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	useEventHub(t)
+	slow, fast := todoEvents.subscribe("alice"), todoEvents.subscribe("alice")
+
+	// Fill the slow stream's buffer while the fast one keeps up
+	for i := 0; i < eventBuffer; i++ {
+		todoEvents.publish("alice", TodoEvent{Type: "deleted", ID: fmt.Sprint(i)})
+		received(fast)
+	}
+	todoEvents.publish("alice", TodoEvent{Type: "deleted", ID: "overflow"})
+
+	// The slow stream gets what was buffered and is then closed
+	events, open := received(slow)
+	if open || len(events) != eventBuffer || events[0].ID != "0" || events[eventBuffer-1].ID != fmt.Sprint(eventBuffer-1) {
+		t.Errorf("slow stream: %d events, open %t, want the %d buffered and closed", len(events), open, eventBuffer)
+	}
+	expectEvents(t, "fast stream", fast, TodoEvent{Type: "deleted", ID: "overflow"})
+
+	// The handler of the dropped stream unsubscribes after publish closed
+	// its channel, which must not close it again
+	todoEvents.unsubscribe("alice", slow)
+	todoEvents.unsubscribe("alice", slow)
+	if !todoEvents.hasSubscribers("alice") {
+		t.Fatal("the fast stream was removed too")
+	}
+	todoEvents.unsubscribe("alice", fast)
+	if _, open := received(fast); open || todoEvents.hasSubscribers("alice") {
+		t.Errorf("after unsubscribing: fast stream open %t, subscribers %v", open, todoEvents.subscribers)
+	}
+}
+
+func TestResyncOnListenerReconnect(t *testing.T) {
+	useEventHub(t)
+	alice, bob := todoEvents.subscribe("alice"), todoEvents.subscribe("bob")
+
+	handleListenerNotification(nil)
+	expectEvents(t, "alice", alice, TodoEvent{Type: "resync"})
+	expectEvents(t, "bob", bob, TodoEvent{Type: "resync"})
+
+	// Notifications are dispatched to their owner
+	handleListenerNotification(&pq.Notification{Channel: todoEventsChannel, Extra: notification("deleted", "t1", "bob")})
+	expectEvents(t, "alice", alice)
+	expectEvents(t, "bob", bob, TodoEvent{Type: "deleted", ID: "t1"})
+}
+
+func TestDispatchTodoNotification(t *testing.T) {
+	todos := useEventHub(t)
+	todos.todos["t1"] = Todo{ID: "t1", Text: "Buy milk", UserID: "alice"}
+	alice := todoEvents.subscribe("alice")
+
+	dispatchTodoNotification(notification("created", "t1", "alice"))
+	expectEvents(t, "created", alice, TodoEvent{Type: "created", ID: "t1", Todo: &Todo{Text: "Buy milk"}})
+
+	// A deleted todo cannot be read, so the event only has the ID
+	lookups := todos.lookupCount()
+	dispatchTodoNotification(notification("deleted", "t1", "alice"))
+	expectEvents(t, "deleted", alice, TodoEvent{Type: "deleted", ID: "t1"})
+	if todos.lookupCount() != lookups {
+		t.Error("deleted event looked up the todo")
+	}
+
+	// Deleted before the update was dispatched: its deleted event follows
+	dispatchTodoNotification(notification("updated", "gone", "alice"))
+	expectEvents(t, "updated after delete", alice)
+
+	// Nobody on this replica is listening to bob: no lookup
+	lookups = todos.lookupCount()
+	dispatchTodoNotification(notification("created", "t1", "bob"))
+	if todos.lookupCount() != lookups {
+		t.Error("todo looked up for a user without streams")
+	}
+
+	// A database error asks the user's streams to fetch again
+	todos.err = errors.New("connection reset")
+	dispatchTodoNotification(notification("updated", "t1", "alice"))
+	expectEvents(t, "database error", alice, TodoEvent{Type: "resync"})
+}
+
+func TestDispatchIgnoresInvalidNotifications(t *testing.T) {
+	todos := useEventHub(t)
+	todos.todos["t1"] = Todo{ID: "t1", Text: "Buy milk"}
+	alice := todoEvents.subscribe("alice")
+
+	for _, payload := range []string{
+		"",
+		"not json",
+		"[]",
+		`{"type": "created", "id": "t1"}`,
+		`{"type": "created", "id": "t1", "user_id": 42}`,
+		`{"type": "created", "id": "t1", "user_id": ""}`,
+	} {
+		dispatchTodoNotification(payload)
+	}
+	expectEvents(t, "alice", alice)
+	if todos.lookupCount() != 0 {
+		t.Errorf("%d lookups for invalid notifications", todos.lookupCount())
+	}
+}
+
+// readEvent reads one Server-Sent Event's lines, up to the blank line.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream after %q: %v", lines, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestTodoEventsStream(t *testing.T) {
+	todos := useEventHub(t)
+	todos.todos["t1"] = Todo{ID: "t1", Text: "Buy milk", Priority: "normal", Tags: []string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleTodoEvents(w, r, User{ID: "alice", Username: "alice"})
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" || resp.Header.Get("Cache-Control") != "no-cache" {
+		t.Fatalf("status %d, headers %v", resp.StatusCode, resp.Header)
+	}
+	stream := bufio.NewReader(resp.Body)
+	if lines := readEvent(t, stream); len(lines) != 1 || lines[0] != "retry: 5000" {
+		t.Errorf("stream starts with %q, want the retry interval", lines)
+	}
+
+	dispatchTodoNotification(notification("deleted", "t0", "alice"))
+	dispatchTodoNotification(notification("created", "t1", "alice"))
+	if lines := readEvent(t, stream); len(lines) != 2 || lines[0] != "event: deleted" || lines[1] != `data: {"type":"deleted","id":"t0"}` {
+		t.Errorf("deleted event = %q", lines)
+	}
+	lines := readEvent(t, stream)
+	if len(lines) != 2 || lines[0] != "event: created" || !strings.HasPrefix(lines[1], "data: ") {
+		t.Fatalf("created event = %q", lines)
+	}
+	var event TodoEvent
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != "created" || event.ID != "t1" || event.Todo == nil || event.Todo.Text != "Buy milk" {
+		t.Errorf("created event data = %+v", event)
+	}
+
+	// Disconnecting unsubscribes the stream
+	resp.Body.Close()
+	for deadline := time.Now().Add(5 * time.Second); todoEvents.hasSubscribers("alice"); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("stream still subscribed after the client disconnected")
+		}
+	}
+}
+
+func TestTodoEventsStreamEndsWhenDropped(t *testing.T) {
+	useEventHub(t)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handleTodoEvents(w, httptest.NewRequest("GET", "/todos/events", nil), User{ID: "alice", Username: "alice"})
+		close(done)
+	}()
+	for !todoEvents.hasSubscribers("alice") {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Close the stream the way publish does when it falls behind
+	todoEvents.mu.Lock()
+	for ch := range todoEvents.subscribers["alice"] {
+		todoEvents.remove("alice", ch)
+	}
+	todoEvents.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still running after its stream was dropped")
+	}
+}
+
+func TestTodoEventsMethodNotAllowed(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleTodoEvents(w, httptest.NewRequest("POST", "/todos/events", nil), User{ID: "alice"})
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", w.Code)
+	}
+}
@@ -5,4 +5,5 @@ go 1.21
 require (
 	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.33.0
 )
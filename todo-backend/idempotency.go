@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// idempotencyKeyTTL is how long a key is remembered. Requests repeating an
+// older key create a new todo.
+var idempotencyKeyTTL = 24 * time.Hour
+
+// requestHash fingerprints a create request, so a key reused for a different
+// todo can be told apart from a retry.
+func requestHash(req CreateTodoRequest) string {
+	b, _ := json.Marshal(req)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// createTodoIdempotent creates todo at most once per Idempotency-Key. The
+// first request stores its response with the key, in the same transaction as
+// the todo; repeats get that response back with Idempotent-Replayed: true.
+// A concurrent repeat waits on the key's row lock until the first commits.
+func createTodoIdempotent(w http.ResponseWriter, user User, key string, req CreateTodoRequest, todo Todo) {
+	hash := requestHash(req)
+	// Keys are per user, so users cannot see or block each other's requests
+	key = user.ID + "/" + key
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /todos - Database error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Forget expired keys first so they can be reused
+	if _, err := tx.Exec(
+		"DELETE FROM idempotency_keys WHERE key = $1 AND created_at < NOW() - make_interval(secs => $2)",
+		key, idempotencyKeyTTL.Seconds(),
+	); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /todos - Database error expiring idempotency key: %v", err)
+		return
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO idempotency_keys (key, request_hash, created_at) VALUES ($1, $2, NOW()) ON CONFLICT (key) DO NOTHING",
+		key, hash,
+	)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /todos - Database error storing idempotency key: %v", err)
+		return
+	}
+
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		tx.Rollback()
+		replayIdempotentResponse(w, key, hash)
+		return
+	}
+
+	if err := insertTodo(tx, &todo); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /todos - Database error creating todo: %v", err)
+		return
+	}
+
+	response, err := json.Marshal(todo)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE idempotency_keys SET status = $2, response = $3 WHERE key = $1",
+		key, http.StatusCreated, string(response),
+	); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /todos - Database error storing idempotent response: %v", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /todos - Database error committing todo: %v", err)
+		return
+	}
+
+	// Old keys are cleaned up lazily; a failure here does not matter
+	if _, err := db.Exec(
+		"DELETE FROM idempotency_keys WHERE created_at < NOW() - make_interval(secs => $1)",
+		idempotencyKeyTTL.Seconds(),
+	); err != nil {
+		log.Printf("POST /todos - Error deleting expired idempotency keys: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(append(response, '\n'))
+
+	log.Printf("POST /todos - SUCCESS: Created todo %s - %s (Idempotency-Key %s)", todo.ID, todo.Text, key)
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, key, hash string) {
+	var storedHash string
+	var status sql.NullInt64
+	var response sql.NullString
+	err := db.QueryRow(
+		"SELECT request_hash, status, response FROM idempotency_keys WHERE key = $1",
+		key,
+	).Scan(&storedHash, &status, &response)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /todos - Database error reading idempotency key: %v", err)
+		return
+	}
+
+	if storedHash != hash {
+		log.Printf("POST /todos - REJECTED: Idempotency-Key %s reused with a different request", key)
+		http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !status.Valid || !response.Valid {
+		// Only possible if the first request's transaction is still open
+		http.Error(w, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	}
+
+	log.Printf("POST /todos - REPLAYED: Idempotency-Key %s", key)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(status.Int64))
+	fmt.Fprintln(w, response.String)
+}
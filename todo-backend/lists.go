@@ -0,0 +1,531 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const maxListNameLength = 100
+
+// Todos are ordered by position within a list. New positions are placed
+// halfway between the neighbours, so moving a todo updates only that todo.
+// When the halves get smaller than minPositionGap the list is renumbered
+// positionGap apart.
+const (
+	positionGap    = 1024
+	minPositionGap = 1e-6
+)
+
+type List struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Default    bool       `json:"default"`
+	Archived   bool       `json:"archived"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	TodoCount  int        `json:"todo_count"`
+	DoneCount  int        `json:"done_count"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateListRequest struct {
+	Name string `json:"name"`
+}
+
+// UpdateListRequest renames a list or archives and restores it.
+type UpdateListRequest struct {
+	Name     *string `json:"name"`
+	Archived *bool   `json:"archived"`
+}
+
+// MoveTodoRequest moves a todo right after another todo of the same list,
+// or to the top when After is empty.
+type MoveTodoRequest struct {
+	TodoID string `json:"todo_id"`
+	After  string `json:"after"`
+}
+
+var (
+	errListNotFound = errors.New("List not found")
+	errListArchived = errors.New("List is archived")
+	errListDefault  = errors.New("The default list cannot be archived or deleted")
+)
+
+// listColumns are selected in the order scanList expects, with the todo
+// counts from a LEFT JOIN on todos.
+const listColumns = `l.id, l.name, l.is_default, l.archived_at, l.created_at,
+	COUNT(t.id), COUNT(t.id) FILTER (WHERE t.done)`
+
+const listFrom = " FROM lists l LEFT JOIN todos t ON t.list_id = l.id"
+
+func scanList(row scanner) (List, error) {
+	var list List
+	var archivedAt sql.NullTime
+	err := row.Scan(&list.ID, &list.Name, &list.Default, &archivedAt, &list.CreatedAt, &list.TodoCount, &list.DoneCount)
+	if archivedAt.Valid {
+		list.Archived = true
+		list.ArchivedAt = &archivedAt.Time
+	}
+	return list, err
+}
+
+// handleLists serves /lists and everything below it. Every list belongs to
+// a user; other users' lists are answered with 404.
+func handleLists(w http.ResponseWriter, r *http.Request, user User) {
+	// /lists, /lists/{id}, /lists/{id}/todos or /lists/{id}/todos/move
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/lists"), "/"), "/")
+	switch {
+	case parts[0] == "":
+		switch r.Method {
+		case "GET":
+			handleGetLists(w, r, user)
+		case "POST":
+			handleCreateList(w, r, user)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 1:
+		switch r.Method {
+		case "GET":
+			handleGetList(w, r, user, parts[0])
+		case "PATCH":
+			handleUpdateList(w, r, user, parts[0])
+		case "DELETE":
+			handleDeleteList(w, r, user, parts[0])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 2 && parts[1] == "todos":
+		route := r.Method + " /lists/" + parts[0] + "/todos"
+		switch r.Method {
+		case "GET":
+			if _, err := getList(db, user.ID, parts[0]); err != nil {
+				writeListError(w, route, err)
+				return
+			}
+			handleGetTodos(w, r, user, route, parts[0])
+		case "POST":
+			handleCreateTodo(w, r, user, route, parts[0])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 3 && parts[1] == "todos" && parts[2] == "move":
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handleMoveTodo(w, r, user, parts[0])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleGetLists returns the user's lists, oldest first. Archived lists are
+// only included with ?archived=true.
+func handleGetLists(w http.ResponseWriter, r *http.Request, user User) {
+	log.Printf("GET /lists - Request from %s", r.RemoteAddr)
+
+	where := " WHERE l.user_id = $1 AND l.archived_at IS NULL"
+	if r.URL.Query().Get("archived") == "true" {
+		where = " WHERE l.user_id = $1"
+	}
+
+	rows, err := db.Query("SELECT "+listColumns+listFrom+where+" GROUP BY l.id ORDER BY l.created_at, l.id", user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("GET /lists - Error querying lists: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("GET /lists - Error scanning list: %v", err)
+			return
+		}
+		lists = append(lists, list)
+	}
+
+	log.Printf("GET /lists - Returning %d lists", len(lists))
+	writeJSON(w, http.StatusOK, lists)
+}
+
+func handleGetList(w http.ResponseWriter, r *http.Request, user User, id string) {
+	log.Printf("GET /lists/%s - Request from %s", id, r.RemoteAddr)
+
+	list, err := getList(db, user.ID, id)
+	if err != nil {
+		writeListError(w, "GET /lists/"+id, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func handleCreateList(w http.ResponseWriter, r *http.Request, user User) {
+	log.Printf("POST /lists - Request from %s", r.RemoteAddr)
+
+	var req CreateListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("POST /lists - Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	list := List{
+		ID:        uuid.New().String(),
+		Name:      strings.TrimSpace(req.Name),
+		CreatedAt: time.Now(),
+	}
+	if err := validateListName(list.Name); err != nil {
+		log.Printf("POST /lists - REJECTED: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.Exec(
+		"INSERT INTO lists (id, name, user_id, created_at) VALUES ($1, $2, $3, $4)",
+		list.ID, list.Name, user.ID, list.CreatedAt,
+	); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("POST /lists - Database error creating list: %v", err)
+		return
+	}
+
+	log.Printf("POST /lists - SUCCESS: Created list %s - %s", list.ID, list.Name)
+	writeJSON(w, http.StatusCreated, list)
+}
+
+func handleUpdateList(w http.ResponseWriter, r *http.Request, user User, id string) {
+	route := "PATCH /lists/" + id
+	log.Printf("%s - Request from %s", route, r.RemoteAddr)
+
+	var req UpdateListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("%s - Invalid request body: %v", route, err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if err := validateListName(name); err != nil {
+			log.Printf("%s - REJECTED: %v", route, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Name = &name
+	}
+	list, err := getList(db, user.ID, id)
+	if err != nil {
+		writeListError(w, route, err)
+		return
+	}
+	if req.Archived != nil && *req.Archived && list.Default {
+		writeListError(w, route, errListDefault)
+		return
+	}
+
+	// archived_at keeps its time when a list is archived again
+	result, err := db.Exec(`
+		UPDATE lists SET
+			name = COALESCE($2, name),
+			archived_at = CASE
+				WHEN $3::BOOLEAN IS NULL THEN archived_at
+				WHEN $3 THEN COALESCE(archived_at, NOW())
+				ELSE NULL
+			END
+		WHERE id = $1 AND user_id = $4`,
+		id, req.Name, req.Archived, user.ID,
+	)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("%s - Database error updating list: %v", route, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		writeListError(w, route, errListNotFound)
+		return
+	}
+
+	list, err = getList(db, user.ID, id)
+	if err != nil {
+		writeListError(w, route, err)
+		return
+	}
+
+	log.Printf("%s - SUCCESS: Updated list - %s (archived: %t)", route, list.Name, list.Archived)
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleDeleteList archives the list, which hides it and its todos but keeps
+// them, or with ?cascade=true deletes the list and all its todos.
+func handleDeleteList(w http.ResponseWriter, r *http.Request, user User, id string) {
+	route := "DELETE /lists/" + id
+	log.Printf("%s - Request from %s", route, r.RemoteAddr)
+
+	cascade := r.URL.Query().Get("cascade") == "true"
+
+	// The default list is left alone by the is_default condition, and
+	// reported below
+	var result sql.Result
+	var err error
+	if cascade {
+		// The todos go with it through ON DELETE CASCADE
+		result, err = db.Exec("DELETE FROM lists WHERE id = $1 AND user_id = $2 AND NOT is_default", id, user.ID)
+	} else {
+		result, err = db.Exec(
+			"UPDATE lists SET archived_at = COALESCE(archived_at, NOW()) WHERE id = $1 AND user_id = $2 AND NOT is_default",
+			id, user.ID,
+		)
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("%s - Database error deleting list: %v", route, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := getList(db, user.ID, id); err != nil {
+			writeListError(w, route, err)
+		} else {
+			writeListError(w, route, errListDefault)
+		}
+		return
+	}
+
+	if cascade {
+		log.Printf("%s - SUCCESS: Deleted list and its todos", route)
+	} else {
+		log.Printf("%s - SUCCESS: Archived list", route)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMoveTodo serves POST /lists/{id}/todos/move. Only the moved todo's
+// position changes, unless the list has to be renumbered.
+func handleMoveTodo(w http.ResponseWriter, r *http.Request, user User, listID string) {
+	route := "POST /lists/" + listID + "/todos/move"
+	log.Printf("%s - Request from %s", route, r.RemoteAddr)
+
+	var req MoveTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TodoID == "" {
+		log.Printf("%s - Invalid request body: %v", route, err)
+		http.Error(w, "Invalid request body: todo_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.After == req.TodoID {
+		http.Error(w, "A todo cannot be moved after itself", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("%s - Database error starting transaction: %v", route, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := checkListWritable(tx, user.ID, listID); err != nil {
+		writeListError(w, route, err)
+		return
+	}
+
+	// Locking the list serializes moves within it
+	if _, err := tx.Exec("SELECT 1 FROM lists WHERE id = $1 FOR UPDATE", listID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("%s - Database error locking list: %v", route, err)
+		return
+	}
+
+	todo, err := scanTodo(tx.QueryRow("SELECT "+todoColumns+" FROM todos WHERE id = $1 AND list_id = $2", req.TodoID, listID))
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("%s - Todo %s not found in the list", route, req.TodoID)
+		http.Error(w, "Todo not found in this list", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("%s - Database error reading todo: %v", route, err)
+		return
+	}
+
+	todo.Position, err = positionAfter(tx, listID, todo.ID, req.After)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("%s - Todo %s not found in the list", route, req.After)
+		http.Error(w, "after: todo not found in this list", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("%s - Database error positioning todo: %v", route, err)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE todos SET position = $2 WHERE id = $1", todo.ID, todo.Position); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("%s - Database error moving todo: %v", route, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("%s - Database error committing move: %v", route, err)
+		return
+	}
+
+	log.Printf("%s - SUCCESS: Moved todo %s to position %g", route, todo.ID, todo.Position)
+	writeJSON(w, http.StatusOK, todo)
+}
+
+// positionAfter returns a position for todoID right after the todo after,
+// or at the top if after is empty, between the neighbours it will have. If
+// they are too close the list is renumbered first. It returns sql.ErrNoRows
+// if after is not in the list.
+func positionAfter(q querier, listID, todoID, after string) (float64, error) {
+	for renumbered := false; ; renumbered = true {
+		var prev, next sql.NullFloat64
+		if after != "" {
+			var p float64
+			if err := q.QueryRow(
+				"SELECT position FROM todos WHERE id = $1 AND list_id = $2", after, listID,
+			).Scan(&p); err != nil {
+				return 0, err
+			}
+			prev = sql.NullFloat64{Float64: p, Valid: true}
+		}
+
+		// The first todo after prev, other than the two being positioned
+		if err := q.QueryRow(`
+			SELECT MIN(position) FROM todos
+			WHERE list_id = $1 AND id <> $2 AND id <> $3 AND ($4::DOUBLE PRECISION IS NULL OR position >= $4)`,
+			listID, todoID, after, prev,
+		).Scan(&next); err != nil {
+			return 0, err
+		}
+
+		switch {
+		case !prev.Valid && !next.Valid:
+			return 0, nil
+		case !prev.Valid:
+			return next.Float64 - positionGap, nil
+		case !next.Valid:
+			return prev.Float64 + positionGap, nil
+		case next.Float64-prev.Float64 >= minPositionGap || renumbered:
+			return (prev.Float64 + next.Float64) / 2, nil
+		}
+
+		if err := renumberList(q, listID); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// renumberList spreads the positions of a list positionGap apart, keeping
+// their order.
+func renumberList(q querier, listID string) error {
+	log.Printf("Renumbering todo positions in list %s", listID)
+	_, err := q.Exec(`
+		UPDATE todos SET position = ordered.n * $2
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY position, created_at DESC) AS n
+			FROM todos WHERE list_id = $1
+		) AS ordered
+		WHERE todos.id = ordered.id`,
+		listID, positionGap,
+	)
+	return err
+}
+
+// topPosition returns a position above every todo in the list.
+func topPosition(q querier, listID string) (float64, error) {
+	var position float64
+	err := q.QueryRow(
+		"SELECT COALESCE(MIN(position) - $2, 0) FROM todos WHERE list_id = $1", listID, positionGap,
+	).Scan(&position)
+	return position, err
+}
+
+// getList returns the user's list, or errListNotFound if the list does not
+// exist or belongs to someone else.
+func getList(q querier, userID, id string) (List, error) {
+	list, err := scanList(q.QueryRow("SELECT "+listColumns+listFrom+" WHERE l.id = $1 AND l.user_id = $2 GROUP BY l.id", id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return list, errListNotFound
+	}
+	return list, err
+}
+
+// defaultList returns the ID of the user's default list, which POST /todos
+// without a list_id adds to.
+func defaultList(q querier, userID string) (string, error) {
+	var id string
+	err := q.QueryRow("SELECT id FROM lists WHERE user_id = $1 AND is_default", userID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errListNotFound
+	}
+	return id, err
+}
+
+// checkListWritable returns errListNotFound or errListArchived unless the
+// user can add todos to or move todos within the list.
+func checkListWritable(q querier, userID, id string) error {
+	var archivedAt sql.NullTime
+	err := q.QueryRow("SELECT archived_at FROM lists WHERE id = $1 AND user_id = $2", id, userID).Scan(&archivedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errListNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if archivedAt.Valid {
+		return errListArchived
+	}
+	return nil
+}
+
+// writeListError answers 404 for errListNotFound, 409 for errListArchived
+// and errListDefault, and 500 for database errors.
+func writeListError(w http.ResponseWriter, route string, err error) {
+	switch {
+	case errors.Is(err, errListDefault):
+		log.Printf("%s - REJECTED: default list", route)
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errListNotFound):
+		log.Printf("%s - List not found", route)
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errListArchived):
+		log.Printf("%s - REJECTED: list is archived", route)
+		http.Error(w, "List is archived, restore it with PATCH {\"archived\": false} first", http.StatusConflict)
+	default:
+		log.Printf("%s - Database error reading list: %v", route, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+	}
+}
+
+func validateListName(name string) error {
+	if name == "" {
+		return errors.New("List name is required")
+	}
+	if len(name) > maxListNameLength {
+		return fmt.Errorf("List name must be %d characters or less", maxListNameLength)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
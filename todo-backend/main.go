@@ -1,29 +1,77 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type Todo struct {
-	ID        string    `json:"id"`
-	Text      string    `json:"text"`
-	Done      bool      `json:"done"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string     `json:"id"`
+	Text      string     `json:"text"`
+	URL       string     `json:"url,omitempty"`
+	Notes     string     `json:"notes,omitempty"`
+	Done      bool       `json:"done"`
+	DueAt     *time.Time `json:"due_at,omitempty"`
+	Priority  string     `json:"priority"`
+	Tags      []string   `json:"tags"`
+	ListID    string     `json:"list_id"`
+	Position  float64    `json:"position"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    string     `json:"-"`
 }
 
 type CreateTodoRequest struct {
-	Text string `json:"text"`
+	Text     string   `json:"text"`
+	URL      string   `json:"url,omitempty"`
+	Notes    string   `json:"notes,omitempty"`
+	DueAt    string   `json:"due_at,omitempty"`
+	Priority string   `json:"priority,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	ListID   string   `json:"list_id,omitempty"`
 }
 
+// UpdateTodoRequest changes the fields that are present and leaves the
+// others as they are. An empty due_at removes the due date. A new list_id
+// moves the todo to the top of that list.
+type UpdateTodoRequest struct {
+	Text     *string   `json:"text"`
+	URL      *string   `json:"url"`
+	Notes    *string   `json:"notes"`
+	Done     *bool     `json:"done"`
+	DueAt    *string   `json:"due_at"`
+	Priority *string   `json:"priority"`
+	Tags     *[]string `json:"tags"`
+	ListID   *string   `json:"list_id"`
+}
+
+const (
+	maxTextLength  = 140
+	maxURLLength   = 2048
+	maxNotesLength = 1000
+	maxTags        = 10
+	maxTagLength   = 30
+)
+
+var priorities = []string{"low", "normal", "high"}
+
+// todoColumns are selected in the order scanTodo expects.
+const todoColumns = "id, text, url, notes, done, due_at, priority, tags, list_id, position, created_at"
+
 var db *sql.DB
 
 func main() {
@@ -51,78 +99,236 @@ func main() {
 	}
 
 	// Initialize database schema
-	if err := initDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	if err := migrateDB(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	if ttl := os.Getenv("IDEMPOTENCY_KEY_TTL"); ttl != "" {
+		idempotencyKeyTTL, err = time.ParseDuration(ttl)
+		if err != nil || idempotencyKeyTTL <= 0 {
+			log.Fatalf("Invalid IDEMPOTENCY_KEY_TTL %q: must be a positive duration", ttl)
+		}
+	}
+
+	keyFile := os.Getenv("JWT_SIGNING_KEY_FILE")
+	if keyFile == "" {
+		keyFile = "/etc/todo-backend/jwt/signing-key"
+	}
+	if signingKey, err = loadSigningKey(keyFile); err != nil {
+		log.Fatalf("Failed to load JWT signing key: %v", err)
+	}
+
+	if ttl := os.Getenv("SESSION_TTL"); ttl != "" {
+		sessionTTL, err = time.ParseDuration(ttl)
+		if err != nil || sessionTTL <= 0 {
+			log.Fatalf("Invalid SESSION_TTL %q: must be a positive duration", ttl)
+		}
+	}
+	allowRegistration = os.Getenv("ALLOW_REGISTRATION") == "true"
+	adminUsername = strings.ToLower(strings.TrimSpace(os.Getenv("ADMIN_USERNAME")))
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowedOrigins = append(allowedOrigins, origin)
+		}
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		var clientIDs []string
+		for _, id := range strings.Split(os.Getenv("OIDC_CLIENT_ID"), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				clientIDs = append(clientIDs, id)
+			}
+		}
+		if len(clientIDs) == 0 {
+			log.Fatal("OIDC_CLIENT_ID is required with OIDC_ISSUER")
+		}
+		usernameClaim := os.Getenv("OIDC_USERNAME_CLAIM")
+		if usernameClaim == "" {
+			usernameClaim = "preferred_username"
+		}
+		cacheTTL := time.Hour
+		if ttl := os.Getenv("OIDC_JWKS_CACHE_TTL"); ttl != "" {
+			cacheTTL, err = time.ParseDuration(ttl)
+			if err != nil || cacheTTL <= 0 {
+				log.Fatalf("Invalid OIDC_JWKS_CACHE_TTL %q: must be a positive duration", ttl)
+			}
+		}
+		oidcVerifier = NewOIDCVerifier(issuer, os.Getenv("OIDC_JWKS_URL"), clientIDs, usernameClaim, cacheTTL)
+	}
+
+	userStore = NewPostgresUserStore(db)
+	if adminUsername != "" {
+		passwordFile := os.Getenv("ADMIN_PASSWORD_FILE")
+		if passwordFile == "" {
+			log.Fatal("ADMIN_PASSWORD_FILE is required with ADMIN_USERNAME")
+		}
+		if err := bootstrapAdmin(context.Background(), passwordFile); err != nil {
+			log.Fatalf("Failed to create admin account: %v", err)
+		}
 	}
+	go listenTodoEvents(dbURL)
 
 	// Setup routes
-	http.HandleFunc("/todos", handleTodos)
+	http.HandleFunc("/todos", requireUser(false, handleTodos))
+	http.HandleFunc("/todos/", requireUser(false, handleTodo))
+	http.HandleFunc("/todos/events", requireUser(false, handleTodoEvents))
+	http.HandleFunc("/tags", requireUser(false, handleTags))
+	http.HandleFunc("/lists", requireUser(false, handleLists))
+	http.HandleFunc("/lists/", requireUser(false, handleLists))
+	registerAuthHandlers()
 	http.HandleFunc("/healthz", handleHealth)
 
 	fmt.Printf("Todo-backend server started on port %s\n", port)
 	fmt.Printf("Database connected: %s\n", dbURL)
+	if !allowRegistration {
+		fmt.Println("Registration disabled (ALLOW_REGISTRATION is not true)")
+	}
+	if adminUsername != "" {
+		fmt.Printf("Admin account: %s\n", adminUsername)
+	}
+	if oidcVerifier != nil {
+		fmt.Printf("OIDC login enabled for issuer %s\n", oidcVerifier.Issuer)
+	}
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func initDB() error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS todos (
-			id TEXT PRIMARY KEY,
-			text TEXT NOT NULL,
-			done BOOLEAN NOT NULL DEFAULT FALSE,
-			created_at TIMESTAMP NOT NULL DEFAULT NOW()
-		)
-	`)
-	return err
+func handleTodos(w http.ResponseWriter, r *http.Request, user User) {
+	switch r.Method {
+	case "GET":
+		handleGetTodos(w, r, user, "GET /todos", "")
+	case "POST":
+		handleCreateTodo(w, r, user, "POST /todos", "")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
 }
 
-func handleTodos(w http.ResponseWriter, r *http.Request) {
-	// Enable CORS for frontend
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	// Handle preflight request
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+// handleTodo serves /todos/{id}.
+func handleTodo(w http.ResponseWriter, r *http.Request, user User) {
+	id := strings.TrimPrefix(r.URL.Path, "/todos/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
 		return
 	}
 
 	switch r.Method {
-	case "GET":
-		handleGetTodos(w, r)
-	case "POST":
-		handleCreateTodo(w, r)
+	case "PUT":
+		handleUpdateTodo(w, r, user, id)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-func handleGetTodos(w http.ResponseWriter, r *http.Request) {
-	log.Printf("GET /todos - Request from %s", r.RemoteAddr)
+// todoFilter holds the GET /todos query parameters, the owner and the list
+// for GET /lists/{id}/todos.
+type todoFilter struct {
+	UserID    string
+	ListID    string
+	Tags      []string
+	Priority  string
+	DueBefore *time.Time
+}
+
+func parseTodoFilter(values url.Values) (todoFilter, error) {
+	var filter todoFilter
+
+	for _, tag := range values["tag"] {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return filter, err
+		}
+		filter.Tags = append(filter.Tags, tag)
+	}
+
+	if priority := values.Get("priority"); priority != "" {
+		if !slices.Contains(priorities, priority) {
+			return filter, fmt.Errorf("priority must be one of %s", strings.Join(priorities, ", "))
+		}
+		filter.Priority = priority
+	}
+
+	if dueBefore := values.Get("due_before"); dueBefore != "" {
+		t, err := parseDueAt(dueBefore)
+		if err != nil {
+			return filter, fmt.Errorf("due_before: %w", err)
+		}
+		filter.DueBefore = t
+	}
+
+	return filter, nil
+}
+
+// where builds the WHERE clause and its arguments. Several tags match todos
+// that have all of them. Without a list, todos in archived lists are left out.
+func (f todoFilter) where() (string, []any) {
+	conditions := []string{"user_id = $1"}
+	args := []any{f.UserID}
 
-	rows, err := db.Query("SELECT id, text, done, created_at FROM todos ORDER BY created_at DESC")
+	if f.ListID != "" {
+		args = append(args, f.ListID)
+		conditions = append(conditions, fmt.Sprintf("list_id = $%d", len(args)))
+	} else {
+		conditions = append(conditions, "list_id NOT IN (SELECT id FROM lists WHERE archived_at IS NOT NULL)")
+	}
+
+	if len(f.Tags) > 0 {
+		args = append(args, pq.Array(f.Tags))
+		conditions = append(conditions, fmt.Sprintf("tags @> $%d", len(args)))
+	}
+	if f.Priority != "" {
+		args = append(args, f.Priority)
+		conditions = append(conditions, fmt.Sprintf("priority = $%d", len(args)))
+	}
+	if f.DueBefore != nil {
+		args = append(args, *f.DueBefore)
+		conditions = append(conditions, fmt.Sprintf("due_at < $%d", len(args)))
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// handleGetTodos serves GET /todos, newest first, and GET /lists/{id}/todos
+// in the list's order.
+func handleGetTodos(w http.ResponseWriter, r *http.Request, user User, route, listID string) {
+	log.Printf("%s - Request from %s", route, r.RemoteAddr)
+
+	filter, err := parseTodoFilter(r.URL.Query())
+	if err != nil {
+		log.Printf("%s - REJECTED: %v", route, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.UserID = user.ID
+	filter.ListID = listID
+
+	order := " ORDER BY created_at DESC"
+	if listID != "" {
+		order = " ORDER BY position, created_at DESC"
+	}
+
+	where, args := filter.where()
+	rows, err := db.Query("SELECT "+todoColumns+" FROM todos"+where+order, args...)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
-		log.Printf("GET /todos - Error querying todos: %v", err)
+		log.Printf("%s - Error querying todos: %v", route, err)
 		return
 	}
 	defer rows.Close()
 
 	todos := []Todo{}
 	for rows.Next() {
-		var todo Todo
-		if err := rows.Scan(&todo.ID, &todo.Text, &todo.Done, &todo.CreatedAt); err != nil {
+		todo, err := scanTodo(rows)
+		if err != nil {
 			http.Error(w, "Database error", http.StatusInternalServerError)
-			log.Printf("GET /todos - Error scanning todo: %v", err)
+			log.Printf("%s - Error scanning todo: %v", route, err)
 			return
 		}
 		todos = append(todos, todo)
 	}
 
-	log.Printf("GET /todos - Returning %d todos", len(todos))
+	log.Printf("%s - Returning %d todos", route, len(todos))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(todos); err != nil {
@@ -131,45 +337,103 @@ func handleGetTodos(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func handleCreateTodo(w http.ResponseWriter, r *http.Request) {
-	log.Printf("POST /todos - Request from %s", r.RemoteAddr)
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTodo reads a row selected with todoColumns.
+func scanTodo(row scanner) (Todo, error) {
+	var todo Todo
+	var dueAt sql.NullTime
+	err := row.Scan(&todo.ID, &todo.Text, &todo.URL, &todo.Notes, &todo.Done, &dueAt,
+		&todo.Priority, pq.Array(&todo.Tags), &todo.ListID, &todo.Position, &todo.CreatedAt)
+	if dueAt.Valid {
+		todo.DueAt = &dueAt.Time
+	}
+	if todo.Tags == nil {
+		todo.Tags = []string{}
+	}
+	return todo, err
+}
+
+// handleCreateTodo serves POST /todos, which adds to the list in the body or
+// the user's default list, and POST /lists/{id}/todos. New todos go to the
+// top of their list.
+func handleCreateTodo(w http.ResponseWriter, r *http.Request, user User, route, listID string) {
+	log.Printf("%s - Request from %s", route, r.RemoteAddr)
 
 	var req CreateTodoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("POST /todos - Invalid request body: %v", err)
+		log.Printf("%s - Invalid request body: %v", route, err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("POST /todos - Received todo text (length: %d): %s", len(req.Text), req.Text)
+	log.Printf("%s - Received todo text (length: %d): %s", route, len(req.Text), req.Text)
 
-	if req.Text == "" {
-		log.Printf("POST /todos - REJECTED: Empty todo text")
-		http.Error(w, "Todo text is required", http.StatusBadRequest)
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		log.Printf("%s - REJECTED: Idempotency-Key too long (%d characters)", route, len(idempotencyKey))
+		http.Error(w, fmt.Sprintf("Idempotency-Key must be %d characters or less", maxIdempotencyKeyLength), http.StatusBadRequest)
 		return
 	}
 
-	// Validate length (max 140 characters)
-	if len(req.Text) > 140 {
-		log.Printf("POST /todos - REJECTED: Todo text too long (%d characters): %s", len(req.Text), req.Text)
-		http.Error(w, "Todo text must be 140 characters or less", http.StatusBadRequest)
-		return
+	if listID != "" {
+		if req.ListID != "" && req.ListID != listID {
+			log.Printf("%s - REJECTED: list_id %s does not match the URL", route, req.ListID)
+			http.Error(w, "list_id does not match the list in the URL", http.StatusBadRequest)
+			return
+		}
+		req.ListID = listID
 	}
 
 	todo := Todo{
 		ID:        uuid.New().String(),
 		Text:      req.Text,
+		URL:       req.URL,
+		Notes:     req.Notes,
 		Done:      false,
+		Priority:  req.Priority,
+		Tags:      req.Tags,
+		ListID:    req.ListID,
 		CreatedAt: time.Now(),
+		UserID:    user.ID,
 	}
 
-	_, err := db.Exec(
-		"INSERT INTO todos (id, text, done, created_at) VALUES ($1, $2, $3, $4)",
-		todo.ID, todo.Text, todo.Done, todo.CreatedAt,
-	)
-	if err != nil {
+	var err error
+	if todo.ListID == "" {
+		if todo.ListID, err = defaultList(db, user.ID); err != nil {
+			writeListError(w, route, err)
+			return
+		}
+	}
+
+	if todo.DueAt, err = parseDueAt(req.DueAt); err != nil {
+		log.Printf("%s - REJECTED: Invalid due_at %q: %v", route, req.DueAt, err)
+		http.Error(w, "Todo due_at: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateTodo(&todo); err != nil {
+		log.Printf("%s - REJECTED: %v", route, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := checkListWritable(db, user.ID, todo.ListID); err != nil {
+		writeListError(w, route, err)
+		return
+	}
+
+	if idempotencyKey != "" {
+		createTodoIdempotent(w, user, idempotencyKey, req, todo)
+		return
+	}
+
+	if err := insertTodo(db, &todo); err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
-		log.Printf("POST /todos - Database error creating todo: %v", err)
+		log.Printf("%s - Database error creating todo: %v", route, err)
 		return
 	}
 
@@ -180,7 +444,264 @@ func handleCreateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("POST /todos - SUCCESS: Created todo %s - %s", todo.ID, todo.Text)
+	log.Printf("%s - SUCCESS: Created todo %s - %s", route, todo.ID, todo.Text)
+}
+
+func handleUpdateTodo(w http.ResponseWriter, r *http.Request, user User, id string) {
+	log.Printf("PUT /todos/%s - Request from %s", id, r.RemoteAddr)
+
+	var req UpdateTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("PUT /todos/%s - Invalid request body: %v", id, err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("PUT /todos/%s - Database error starting transaction: %v", id, err)
+		return
+	}
+	defer tx.Rollback()
+
+	todo, err := scanTodo(tx.QueryRow("SELECT "+todoColumns+" FROM todos WHERE id = $1 AND user_id = $2 FOR UPDATE", id, user.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("PUT /todos/%s - Todo not found", id)
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("PUT /todos/%s - Database error reading todo: %v", id, err)
+		return
+	}
+
+	if req.Text != nil {
+		todo.Text = *req.Text
+	}
+	if req.URL != nil {
+		todo.URL = *req.URL
+	}
+	if req.Notes != nil {
+		todo.Notes = *req.Notes
+	}
+	if req.Done != nil {
+		todo.Done = *req.Done
+	}
+	if req.DueAt != nil {
+		if todo.DueAt, err = parseDueAt(*req.DueAt); err != nil {
+			log.Printf("PUT /todos/%s - REJECTED: Invalid due_at %q: %v", id, *req.DueAt, err)
+			http.Error(w, "Todo due_at: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Priority != nil {
+		todo.Priority = *req.Priority
+	}
+	if req.Tags != nil {
+		todo.Tags = *req.Tags
+	}
+
+	if err := validateTodo(&todo); err != nil {
+		log.Printf("PUT /todos/%s - REJECTED: %v", id, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.ListID != nil && *req.ListID != todo.ListID {
+		if err := checkListWritable(tx, user.ID, *req.ListID); err != nil {
+			writeListError(w, "PUT /todos/"+id, err)
+			return
+		}
+		todo.ListID = *req.ListID
+		if todo.Position, err = topPosition(tx, todo.ListID); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("PUT /todos/%s - Database error positioning todo: %v", id, err)
+			return
+		}
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE todos SET text = $2, url = $3, notes = $4, done = $5, due_at = $6, priority = $7, tags = $8, list_id = $9, position = $10 WHERE id = $1 AND user_id = $11",
+		todo.ID, todo.Text, todo.URL, todo.Notes, todo.Done, todo.DueAt, todo.Priority, pq.Array(todo.Tags), todo.ListID, todo.Position, user.ID,
+	); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("PUT /todos/%s - Database error updating todo: %v", id, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("PUT /todos/%s - Database error committing todo: %v", id, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PUT /todos/%s - SUCCESS: Updated todo - %s", id, todo.Text)
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// insertTodo inserts todo at the top of its list and sets its position.
+func insertTodo(q querier, todo *Todo) error {
+	return q.QueryRow(`
+		INSERT INTO todos (id, text, url, notes, done, due_at, priority, tags, list_id, position, created_at, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9,
+			(SELECT COALESCE(MIN(position) - $10, 0) FROM todos WHERE list_id = $9), $11, $12)
+		RETURNING position`,
+		todo.ID, todo.Text, todo.URL, todo.Notes, todo.Done, todo.DueAt, todo.Priority, pq.Array(todo.Tags),
+		todo.ListID, positionGap, todo.CreatedAt, todo.UserID,
+	).Scan(&todo.Position)
+}
+
+// validateTodo checks the fields a client can set, on create and on update.
+// It defaults the priority to normal and normalizes the tags. Errors are
+// meant for the client.
+func validateTodo(todo *Todo) error {
+	if todo.Text == "" {
+		return errors.New("Todo text is required")
+	}
+	if len(todo.Text) > maxTextLength {
+		return fmt.Errorf("Todo text must be %d characters or less", maxTextLength)
+	}
+	if err := validateURL(todo.URL); err != nil {
+		return err
+	}
+	if len(todo.Notes) > maxNotesLength {
+		return fmt.Errorf("Todo notes must be %d characters or less", maxNotesLength)
+	}
+
+	if todo.Priority == "" {
+		todo.Priority = "normal"
+	}
+	if !slices.Contains(priorities, todo.Priority) {
+		return fmt.Errorf("Todo priority must be one of %s", strings.Join(priorities, ", "))
+	}
+
+	tags := []string{}
+	for _, tag := range todo.Tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxTags {
+		return fmt.Errorf("Todo can have at most %d tags", maxTags)
+	}
+	todo.Tags = tags
+
+	return nil
+}
+
+// normalizeTag lowercases a tag and checks it is a single word of letters,
+// digits, - and _, so tags can be passed in query parameters as they are.
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", errors.New("Todo tags must not be empty")
+	}
+	if utf8.RuneCountInString(tag) > maxTagLength {
+		return "", fmt.Errorf("Todo tag %q must be %d characters or less", tag, maxTagLength)
+	}
+	for _, c := range tag {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '_' {
+			return "", fmt.Errorf("Todo tag %q may only contain letters, digits, - and _", tag)
+		}
+	}
+	return tag, nil
+}
+
+// parseDueAt accepts an RFC3339 timestamp or a date, which means midnight
+// UTC at its start. An empty value means no due date.
+func parseDueAt(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return &t, nil
+	}
+	return nil, fmt.Errorf("%q is neither an RFC3339 timestamp nor a date such as 2025-12-24", value)
+}
+
+// validateURL accepts an empty url or an absolute http(s) URL, so the
+// frontend can render it as a link safely.
+func validateURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if len(raw) > maxURLLength {
+		return fmt.Errorf("Todo url must be %d characters or less", maxURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Todo url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// TagCount is one entry of GET /tags.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// handleTags serves GET /tags: every tag in use in the user's todos with
+// its number of todos, most used first.
+func handleTags(w http.ResponseWriter, r *http.Request, user User) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Printf("GET /tags - Request from %s", r.RemoteAddr)
+
+	rows, err := db.Query(`
+		SELECT tag, COUNT(*) FROM todos, unnest(tags) AS tag
+		WHERE user_id = $1
+		GROUP BY tag ORDER BY COUNT(*) DESC, tag
+	`, user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("GET /tags - Error querying tags: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			log.Printf("GET /tags - Error scanning tag: %v", err)
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	log.Printf("GET /tags - Returning %d tags", len(tags))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tags); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
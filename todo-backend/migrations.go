@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// migrations are applied in order and recorded in schema_migrations. Append
+// new ones, never edit applied ones. The first ones use IF NOT EXISTS
+// because databases from before schema_migrations already have them.
+var migrations = []string{
+	// 1: initial schema
+	`CREATE TABLE IF NOT EXISTS todos (
+		id TEXT PRIMARY KEY,
+		text TEXT NOT NULL,
+		done BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+
+	// 2: links and notes
+	`ALTER TABLE todos ADD COLUMN IF NOT EXISTS url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT ''`,
+
+	// 3: Idempotency-Key responses
+	`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT PRIMARY KEY,
+		request_hash TEXT NOT NULL,
+		status INTEGER,
+		response TEXT,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+
+	// 4: due dates, priorities and tags
+	`ALTER TABLE todos ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'normal'
+		CHECK (priority IN ('low', 'normal', 'high'));
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+	CREATE INDEX IF NOT EXISTS todos_tags_idx ON todos USING GIN (tags);
+	CREATE INDEX IF NOT EXISTS todos_due_at_idx ON todos (due_at)`,
+
+	// 5: lists, with the existing todos in the default list in their
+	// current newest-first order
+	`CREATE TABLE lists (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		archived_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	INSERT INTO lists (id, name) VALUES ('default', 'Todos');
+	ALTER TABLE todos ADD COLUMN list_id TEXT NOT NULL DEFAULT 'default'
+		REFERENCES lists (id) ON DELETE CASCADE;
+	ALTER TABLE todos ADD COLUMN position DOUBLE PRECISION NOT NULL DEFAULT 0;
+	UPDATE todos SET position = ordered.n * 1024
+		FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY created_at DESC) AS n FROM todos) AS ordered
+		WHERE todos.id = ordered.id;
+	CREATE INDEX todos_list_position_idx ON todos (list_id, position)`,
+
+	// 6: user accounts and API tokens. Existing lists and todos have no
+	// owner until the ADMIN_USERNAME account is created and adopts them.
+	`CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE TABLE api_tokens (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		last_used_at TIMESTAMP
+	);
+	ALTER TABLE lists ADD COLUMN user_id TEXT REFERENCES users (id) ON DELETE CASCADE;
+	ALTER TABLE lists ADD COLUMN is_default BOOLEAN NOT NULL DEFAULT FALSE;
+	UPDATE lists SET is_default = TRUE WHERE id = 'default';
+	CREATE UNIQUE INDEX lists_user_default_idx ON lists (user_id) WHERE is_default;
+	ALTER TABLE todos ADD COLUMN user_id TEXT REFERENCES users (id) ON DELETE CASCADE;
+	CREATE INDEX todos_user_created_idx ON todos (user_id, created_at)`,
+
+	// 7: users logging in with OpenID Connect, who have no password
+	`ALTER TABLE users ADD COLUMN oidc_issuer TEXT;
+	ALTER TABLE users ADD COLUMN oidc_subject TEXT;
+	CREATE UNIQUE INDEX users_oidc_identity_idx ON users (oidc_issuer, oidc_subject)
+		WHERE oidc_subject IS NOT NULL`,
+
+	// 8: NOTIFY todo_events on every change to a todo, for GET /todos/events
+	`CREATE FUNCTION notify_todo_event() RETURNS trigger AS $$
+	DECLARE
+		todo todos%ROWTYPE;
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			todo := OLD;
+		ELSE
+			todo := NEW;
+		END IF;
+		PERFORM pg_notify('todo_events', json_build_object(
+			'type', CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END,
+			'id', todo.id,
+			'user_id', todo.user_id
+		)::text);
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+	CREATE TRIGGER todos_notify AFTER INSERT OR UPDATE OR DELETE ON todos
+		FOR EACH ROW EXECUTE FUNCTION notify_todo_event()`,
+}
+
+// migrateDB applies the migrations that are not yet in schema_migrations.
+// An advisory lock keeps replicas starting at the same time from applying
+// them twice.
+func migrateDB() error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Any constant key works, it only has to be the same in every replica
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(4242001)"); err != nil {
+		return err
+	}
+
+	var current int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			return err
+		}
+		log.Printf("Applied database migration %d", version)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Clock skew allowed between us and the OIDC provider
+	oidcLeeway = time.Minute
+
+	// Unknown key IDs make the JWKS be fetched again, but at most this often,
+	// so tokens with made-up key IDs cannot flood the provider
+	minJWKSRefreshInterval = time.Minute
+
+	minRSAKeyBits = 2048
+)
+
+// oidcVerifier is set when OIDC_ISSUER is, and validates ID tokens from that
+// provider.
+var oidcVerifier *OIDCVerifier
+
+// OIDCVerifier validates RS256-signed ID tokens from an OpenID Connect
+// provider against the keys in its JWKS.
+type OIDCVerifier struct {
+	Issuer string
+	// Audiences are the accepted client IDs; the token's aud must contain one
+	Audiences []string
+	// UsernameClaim names the user, falling back to email and then sub
+	UsernameClaim string
+
+	jwks *jwksCache
+}
+
+// oidcIdentity is what a valid ID token says about the user.
+type oidcIdentity struct {
+	Issuer   string
+	Subject  string
+	Username string
+}
+
+type idTokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type idTokenClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt float64  `json:"exp"`
+	NotBefore float64  `json:"nbf"`
+}
+
+// audience is the aud claim, which may be a string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// NewOIDCVerifier returns a verifier for the issuer. With an empty jwksURL
+// the JWKS URL is discovered from the issuer's openid-configuration on first
+// use. The keys are fetched again once they are older than cacheTTL.
+func NewOIDCVerifier(issuer, jwksURL string, audiences []string, usernameClaim string, cacheTTL time.Duration) *OIDCVerifier {
+	return &OIDCVerifier{
+		Issuer:        issuer,
+		Audiences:     audiences,
+		UsernameClaim: usernameClaim,
+		jwks: &jwksCache{
+			issuer: issuer,
+			url:    jwksURL,
+			ttl:    cacheTTL,
+			client: &http.Client{Timeout: 10 * time.Second},
+		},
+	}
+}
+
+// isOIDCToken tells ID tokens from our own session tokens, which always have
+// the same header.
+func isOIDCToken(token string) bool {
+	return !strings.HasPrefix(token, jwtHeader+".")
+}
+
+// Verify checks the token's signature, issuer, audience and validity period
+// and returns the identity in it.
+func (v *OIDCVerifier) Verify(ctx context.Context, token string, now time.Time) (oidcIdentity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return oidcIdentity{}, errors.New("malformed token")
+	}
+
+	var header idTokenHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return oidcIdentity{}, errors.New("malformed token header")
+	}
+	// Only RS256, whatever else the header allows: accepting "none" or HS256
+	// would let anyone sign tokens
+	if header.Alg != "RS256" {
+		return oidcIdentity{}, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+
+	key, err := v.jwks.key(ctx, header.Kid)
+	if err != nil {
+		return oidcIdentity{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return oidcIdentity{}, errors.New("malformed signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return oidcIdentity{}, errors.New("invalid signature")
+	}
+
+	var claims idTokenClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return oidcIdentity{}, errors.New("malformed token claims")
+	}
+	if claims.Issuer != v.Issuer {
+		return oidcIdentity{}, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return oidcIdentity{}, errors.New("token has no subject")
+	}
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool { return slices.Contains(v.Audiences, aud) }) {
+		return oidcIdentity{}, fmt.Errorf("unexpected audience %q", []string(claims.Audience))
+	}
+	if claims.ExpiresAt == 0 || now.Add(-oidcLeeway).After(time.Unix(int64(claims.ExpiresAt), 0)) {
+		return oidcIdentity{}, errors.New("token expired")
+	}
+	if claims.NotBefore != 0 && now.Add(oidcLeeway).Before(time.Unix(int64(claims.NotBefore), 0)) {
+		return oidcIdentity{}, errors.New("token not valid yet")
+	}
+
+	// The username claim is configurable, so it is read separately
+	var extra map[string]any
+	if err := decodeJWTPart(parts[1], &extra); err != nil {
+		return oidcIdentity{}, errors.New("malformed token claims")
+	}
+	username := claims.Subject
+	for _, claim := range []string{v.UsernameClaim, "email"} {
+		if value, ok := extra[claim].(string); ok && strings.TrimSpace(value) != "" {
+			username = strings.ToLower(strings.TrimSpace(value))
+			break
+		}
+	}
+
+	return oidcIdentity{Issuer: claims.Issuer, Subject: claims.Subject, Username: username}, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jwksCache keeps the provider's signing keys by key ID. Providers publish a
+// new key before signing with it, so a token with an unknown key ID means
+// the keys were rotated and makes the cache refresh early.
+type jwksCache struct {
+	issuer string
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// key returns the key with the ID kid. If fetching the JWKS fails, the keys
+// already cached keep being used until the provider is back. The fetch runs
+// without the lock, so a slow provider only delays the request that
+// triggered it; requests meanwhile use the cached keys.
+func (c *jwksCache) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	now := time.Now()
+	key, ok := c.keys[kid]
+	stale := now.Sub(c.fetchedAt) >= c.ttl
+	refresh := (stale || !ok) && now.Sub(c.lastAttempt) >= minJWKSRefreshInterval
+	if refresh {
+		c.lastAttempt = now
+	}
+	url := c.url
+	c.mu.Unlock()
+
+	if refresh {
+		// Not cancelled with the request: a client hanging up should not
+		// waste the attempt for a minute
+		keys, url, err := c.fetch(context.WithoutCancel(ctx), url)
+
+		c.mu.Lock()
+		if err != nil {
+			log.Printf("OIDC - Error fetching JWKS, keeping %d cached keys: %v", len(c.keys), err)
+		} else {
+			c.keys = keys
+			c.url = url
+			c.fetchedAt = time.Now()
+			log.Printf("OIDC - Fetched %d signing keys from %s", len(keys), url)
+		}
+		key, ok = c.keys[kid]
+		c.mu.Unlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetch returns the keys from the JWKS at url, discovering url first if it
+// is empty, and the url it used.
+func (c *jwksCache) fetch(ctx context.Context, url string) (map[string]*rsa.PublicKey, string, error) {
+	if url == "" {
+		var err error
+		if url, err = c.discover(ctx); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := c.getJSON(ctx, url, &jwks); err != nil {
+		return nil, "", err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAKey(k.N, k.E)
+		if err != nil {
+			log.Printf("OIDC - Skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, "", fmt.Errorf("%s has no usable RSA signing keys", url)
+	}
+	return keys, url, nil
+}
+
+// discover reads the JWKS URL from the issuer's openid-configuration.
+func (c *jwksCache) discover(ctx context.Context) (string, error) {
+	var config struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := c.getJSON(ctx, strings.TrimSuffix(c.issuer, "/")+"/.well-known/openid-configuration", &config); err != nil {
+		return "", err
+	}
+	if config.Issuer != c.issuer {
+		return "", fmt.Errorf("openid-configuration is for issuer %q, not %q", config.Issuer, c.issuer)
+	}
+	if config.JWKSURI == "" {
+		return "", errors.New("openid-configuration has no jwks_uri")
+	}
+	return config.JWKSURI, nil
+}
+
+func (c *jwksCache) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status code: %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %w", url, err)
+	}
+	return nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, errors.New("malformed modulus")
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil || len(eBytes) == 0 || len(eBytes) > 4 {
+		return nil, errors.New("malformed exponent")
+	}
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(new(big.Int).SetBytes(eBytes).Int64())}
+	if key.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("key is shorter than %d bits", minRSAKeyBits)
+	}
+	return key, nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOIDCProvider is an in-process issuer serving an openid-configuration
+// and a JWKS with the keys it currently publishes.
+type fakeOIDCProvider struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PrivateKey
+	jwksHits  int
+	jwksDelay time.Duration
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+	p := &fakeOIDCProvider{keys: make(map[string]*rsa.PrivateKey)}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serveHTTP))
+	t.Cleanup(p.Close)
+	p.addKey(t, "key-1")
+	return p
+}
+
+func (p *fakeOIDCProvider) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		json.NewEncoder(w).Encode(map[string]string{"issuer": p.URL, "jwks_uri": p.URL + "/keys"})
+	case "/keys":
+		p.mu.Lock()
+		p.jwksHits++
+		delay := p.jwksDelay
+		keys := []map[string]string{}
+		for kid, key := range p.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		p.mu.Unlock()
+		time.Sleep(delay)
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *fakeOIDCProvider) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.keys[kid] = key
+	p.mu.Unlock()
+}
+
+func (p *fakeOIDCProvider) hits() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.jwksHits
+}
+
+// sign returns a token with the header and claims, signed with the key kid.
+func (p *fakeOIDCProvider) sign(t *testing.T, header, claims map[string]any, kid string) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	p.mu.Lock()
+	key := p.keys[kid]
+	p.mu.Unlock()
+	if key == nil {
+		// Signed by a key the provider does not publish
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	}
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// idToken returns a valid ID token from the provider, with overrides applied
+// to its claims.
+func (p *fakeOIDCProvider) idToken(t *testing.T, kid string, now time.Time, overrides map[string]any) string {
+	claims := map[string]any{
+		"iss":                p.URL,
+		"sub":                "subject-1",
+		"aud":                "todo-client",
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"preferred_username": "Alice@Example.com",
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	return p.sign(t, map[string]any{"alg": "RS256", "typ": "JWT", "kid": kid}, claims, kid)
+}
+
+// expireJWKS makes the next Verify fetch the JWKS again, as if the cache TTL
+// and the refresh interval had passed.
+func expireJWKS(v *OIDCVerifier) {
+	v.jwks.mu.Lock()
+	defer v.jwks.mu.Unlock()
+	v.jwks.fetchedAt = time.Time{}
+	v.jwks.lastAttempt = time.Time{}
+}
+
+func newTestVerifier(p *fakeOIDCProvider) *OIDCVerifier {
+	return NewOIDCVerifier(p.URL, "", []string{"todo-client"}, "preferred_username", time.Hour)
+}
+
+func TestOIDCVerify(t *testing.T) {
+	p := newFakeOIDCProvider(t)
+	v := newTestVerifier(p)
+	now := time.Now()
+
+	identity, err := v.Verify(context.Background(), p.idToken(t, "key-1", now, nil), now)
+	if err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	want := oidcIdentity{Issuer: p.URL, Subject: "subject-1", Username: "alice@example.com"}
+	if identity != want {
+		t.Errorf("identity = %+v, want %+v", identity, want)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"audience in array", p.idToken(t, "key-1", now, map[string]any{"aud": []string{"other", "todo-client"}}), ""},
+		{"wrong audience", p.idToken(t, "key-1", now, map[string]any{"aud": "other-client"}), "unexpected audience"},
+		{"wrong issuer", p.idToken(t, "key-1", now, map[string]any{"iss": "https://evil.example"}), "unexpected issuer"},
+		{"no subject", p.idToken(t, "key-1", now, map[string]any{"sub": ""}), "no subject"},
+		{"expired", p.idToken(t, "key-1", now, map[string]any{"exp": now.Add(-2 * time.Minute).Unix()}), "expired"},
+		{"expired within leeway", p.idToken(t, "key-1", now, map[string]any{"exp": now.Add(-30 * time.Second).Unix()}), ""},
+		{"no exp", p.idToken(t, "key-1", now, map[string]any{"exp": nil}), "expired"},
+		{"not valid yet", p.idToken(t, "key-1", now, map[string]any{"nbf": now.Add(2 * time.Minute).Unix()}), "not valid yet"},
+		{"nbf within leeway", p.idToken(t, "key-1", now, map[string]any{"nbf": now.Add(30 * time.Second).Unix()}), ""},
+		{"HS256", p.sign(t, map[string]any{"alg": "HS256", "kid": "key-1"}, map[string]any{"iss": p.URL}, "key-1"), "unsupported signing algorithm"},
+		{"none", "eyJhbGciOiJub25lIn0.e30.", "unsupported signing algorithm"},
+		{"signed by another key", p.sign(t, map[string]any{"alg": "RS256", "kid": "key-1"}, map[string]any{
+			"iss": p.URL, "sub": "subject-1", "aud": "todo-client", "exp": now.Add(time.Hour).Unix(),
+		}, "unpublished"), "invalid signature"},
+		{"malformed", "not-a-jwt", "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), tt.token, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v, want none", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if hits := p.hits(); hits != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", hits)
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	p := newFakeOIDCProvider(t)
+	v := newTestVerifier(p)
+	now := time.Now()
+
+	if _, err := v.Verify(context.Background(), p.idToken(t, "key-1", now, nil), now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider rotates to key-2. The cache still has the old JWKS and
+	// fetched it under a minute ago, so the new key is not fetched yet.
+	p.addKey(t, "key-2")
+	token := p.idToken(t, "key-2", now, nil)
+	if _, err := v.Verify(context.Background(), token, now); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Fatalf("err = %v, want unknown signing key while throttled", err)
+	}
+	if hits := p.hits(); hits != 1 {
+		t.Fatalf("JWKS fetched %d times within the refresh interval, want 1", hits)
+	}
+
+	// Once the interval has passed, the unknown kid triggers a refresh
+	v.jwks.mu.Lock()
+	v.jwks.lastAttempt = time.Now().Add(-minJWKSRefreshInterval)
+	v.jwks.mu.Unlock()
+	if _, err := v.Verify(context.Background(), token, now); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+	if hits := p.hits(); hits != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", hits)
+	}
+
+	// Made-up kids right after do not hit the provider again
+	for i := 0; i < 5; i++ {
+		v.Verify(context.Background(), p.idToken(t, "made-up", now, nil), now)
+	}
+	if hits := p.hits(); hits != 2 {
+		t.Errorf("JWKS fetched %d times after unknown kids, want 2", hits)
+	}
+}
+
+func TestOIDCCachedKeysSurviveProviderOutage(t *testing.T) {
+	p := newFakeOIDCProvider(t)
+	v := newTestVerifier(p)
+	now := time.Now()
+	token := p.idToken(t, "key-1", now, nil)
+
+	if _, err := v.Verify(context.Background(), token, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider is gone when the keys expire
+	p.Close()
+	expireJWKS(v)
+	if _, err := v.Verify(context.Background(), token, now); err != nil {
+		t.Errorf("with the provider down: %v, want the cached key to be used", err)
+	}
+	v.jwks.mu.Lock()
+	defer v.jwks.mu.Unlock()
+	if v.jwks.lastAttempt.IsZero() {
+		t.Error("no refresh was attempted")
+	}
+}
+
+func TestOIDCSlowRefreshDoesNotBlockOtherRequests(t *testing.T) {
+	p := newFakeOIDCProvider(t)
+	v := newTestVerifier(p)
+	now := time.Now()
+	token := p.idToken(t, "key-1", now, nil)
+	if _, err := v.Verify(context.Background(), token, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next refresh hangs at the provider
+	p.mu.Lock()
+	p.jwksDelay = 2 * time.Second
+	p.mu.Unlock()
+	expireJWKS(v)
+
+	go v.Verify(context.Background(), token, now)
+	for p.hits() < 2 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	start := time.Now()
+	if _, err := v.Verify(context.Background(), token, now); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Verify took %v while another request refreshed the JWKS", elapsed)
+	}
+}
+
+func TestParseRSAKeyRejectsShortKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	if _, err := parseRSAKey(n, e); err == nil {
+		t.Error("1024-bit key accepted")
+	}
+}
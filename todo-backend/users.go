@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type User struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIToken is a long-lived token for machine clients. Only a hash of the
+// token is stored; the token itself is returned once, on creation.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+var (
+	errUserNotFound  = errors.New("user not found")
+	errUsernameTaken = errors.New("username is taken")
+	errTokenNotFound = errors.New("API token not found")
+)
+
+// UserStore keeps accounts and API tokens. It is an interface so the
+// authentication code can run against an in-memory store in tests.
+type UserStore interface {
+	// CreateUser stores a new user, or returns errUsernameTaken. With
+	// adoptOrphans, the user also gets the lists and todos that have no
+	// owner.
+	CreateUser(ctx context.Context, username, passwordHash string, adoptOrphans bool) (User, error)
+	// UserByUsername returns the user and their password hash.
+	UserByUsername(ctx context.Context, username string) (User, string, error)
+	UserByID(ctx context.Context, id string) (User, error)
+	// OIDCUser returns the user for an OpenID Connect identity, creating it
+	// on first login. Its username is only a suggestion.
+	OIDCUser(ctx context.Context, issuer, subject, username string) (User, error)
+
+	CreateAPIToken(ctx context.Context, userID, name, tokenHash string) (APIToken, error)
+	// APITokenUser returns the owner of a token and records its use.
+	APITokenUser(ctx context.Context, tokenHash string) (User, error)
+	APITokens(ctx context.Context, userID string) ([]APIToken, error)
+	DeleteAPIToken(ctx context.Context, userID, id string) error
+}
+
+// postgresUserStore keeps users in the users and api_tokens tables.
+type postgresUserStore struct {
+	db *sql.DB
+}
+
+func NewPostgresUserStore(db *sql.DB) UserStore {
+	return &postgresUserStore{db: db}
+}
+
+// CreateUser also gives the user a default list. Adopted orphans include
+// the old default list, which becomes the user's.
+func (s *postgresUserStore) CreateUser(ctx context.Context, username, passwordHash string, adoptOrphans bool) (User, error) {
+	return s.createUser(ctx, username, passwordHash, sql.NullString{}, sql.NullString{}, adoptOrphans)
+}
+
+// OIDCUser creates users with an empty password hash, so they can only log
+// in through the provider. If the username is taken, a suffix derived from
+// the identity is added.
+func (s *postgresUserStore) OIDCUser(ctx context.Context, issuer, subject, username string) (User, error) {
+	user, err := s.userByIdentity(ctx, issuer, subject)
+	if !errors.Is(err, errUserNotFound) {
+		return user, err
+	}
+
+	suffix := fmt.Sprintf("-%x", sha256.Sum256([]byte(issuer+" "+subject)))[:9]
+	for _, name := range []string{username, username + suffix} {
+		user, err = s.createUser(ctx, name, "",
+			sql.NullString{String: issuer, Valid: true}, sql.NullString{String: subject, Valid: true}, false)
+		if errors.Is(err, errIdentityTaken) {
+			// A concurrent first login created it
+			return s.userByIdentity(ctx, issuer, subject)
+		}
+		if !errors.Is(err, errUsernameTaken) {
+			return user, err
+		}
+	}
+	return User{}, err
+}
+
+func (s *postgresUserStore) userByIdentity(ctx context.Context, issuer, subject string) (User, error) {
+	var user User
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, username, created_at FROM users WHERE oidc_issuer = $1 AND oidc_subject = $2", issuer, subject,
+	).Scan(&user.ID, &user.Username, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, errUserNotFound
+	}
+	return user, err
+}
+
+// errIdentityTaken means the OIDC identity already has a user.
+var errIdentityTaken = errors.New("OIDC identity has a user")
+
+func (s *postgresUserStore) createUser(ctx context.Context, username, passwordHash string, oidcIssuer, oidcSubject sql.NullString, adoptOrphans bool) (User, error) {
+	user := User{ID: uuid.New().String(), Username: username, CreatedAt: time.Now()}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO users (id, username, password_hash, oidc_issuer, oidc_subject, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		user.ID, user.Username, passwordHash, oidcIssuer, oidcSubject, user.CreatedAt,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		if pqErr.Constraint == "users_oidc_identity_idx" {
+			return User{}, errIdentityTaken
+		}
+		return User{}, errUsernameTaken
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	if adoptOrphans {
+		if _, err := tx.ExecContext(ctx, "UPDATE lists SET user_id = $1 WHERE user_id IS NULL", user.ID); err != nil {
+			return User{}, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE todos SET user_id = $1 WHERE user_id IS NULL", user.ID); err != nil {
+			return User{}, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO lists (id, name, user_id, is_default, created_at)
+		SELECT $1, 'Todos', $2, TRUE, $3
+		WHERE NOT EXISTS (SELECT 1 FROM lists WHERE user_id = $2 AND is_default)`,
+		uuid.New().String(), user.ID, user.CreatedAt,
+	); err != nil {
+		return User{}, err
+	}
+
+	return user, tx.Commit()
+}
+
+func (s *postgresUserStore) UserByUsername(ctx context.Context, username string) (User, string, error) {
+	var user User
+	var hash string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, username, created_at, password_hash FROM users WHERE username = $1", username,
+	).Scan(&user.ID, &user.Username, &user.CreatedAt, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, "", errUserNotFound
+	}
+	return user, hash, err
+}
+
+func (s *postgresUserStore) UserByID(ctx context.Context, id string) (User, error) {
+	var user User
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, username, created_at FROM users WHERE id = $1", id,
+	).Scan(&user.ID, &user.Username, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, errUserNotFound
+	}
+	return user, err
+}
+
+func (s *postgresUserStore) CreateAPIToken(ctx context.Context, userID, name, tokenHash string) (APIToken, error) {
+	token := APIToken{ID: uuid.New().String(), Name: name, CreatedAt: time.Now()}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO api_tokens (id, user_id, name, token_hash, created_at) VALUES ($1, $2, $3, $4, $5)",
+		token.ID, userID, name, tokenHash, token.CreatedAt,
+	)
+	return token, err
+}
+
+func (s *postgresUserStore) APITokenUser(ctx context.Context, tokenHash string) (User, error) {
+	var user User
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE api_tokens t SET last_used_at = NOW()
+		FROM users u
+		WHERE t.token_hash = $1 AND u.id = t.user_id
+		RETURNING u.id, u.username, u.created_at`,
+		tokenHash,
+	).Scan(&user.ID, &user.Username, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, errTokenNotFound
+	}
+	return user, err
+}
+
+func (s *postgresUserStore) APITokens(ctx context.Context, userID string) ([]APIToken, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, name, created_at, last_used_at FROM api_tokens WHERE user_id = $1 ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var token APIToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Name, &token.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			token.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *postgresUserStore) DeleteAPIToken(ctx context.Context, userID, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errTokenNotFound
+	}
+	return nil
+}
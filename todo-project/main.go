@@ -53,8 +53,14 @@ func main() {
 	fmt.Printf("Image URL: %s\n", imageURL)
 	fmt.Printf("Image refresh interval: %s\n", imageMaxAge)
 
+	loadOIDCConfig()
+	if oidcConfig.Issuer != "" {
+		fmt.Printf("OIDC login: %s (client %s)\n", oidcConfig.Issuer, oidcConfig.ClientID)
+	}
+
 	http.HandleFunc("/", handleRoot)
 	http.HandleFunc("/image", handleImage)
+	http.HandleFunc("/oidc-config", handleOIDCConfig)
 
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatal(err)
@@ -315,6 +321,100 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
             text-decoration: line-through;
             color: #888;
         }
+        .todo-text a {
+            color: #667eea;
+            font-weight: 600;
+        }
+        .todo-notes {
+            display: block;
+            color: #888;
+            font-size: 0.85em;
+            margin-top: 4px;
+        }
+        .todo-details {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 10px;
+            margin-bottom: 10px;
+        }
+        .todo-details input, .todo-details select {
+            padding: 8px;
+            border: 2px solid #e0e0e0;
+            border-radius: 8px;
+            font-size: 0.9em;
+        }
+        .todo-details input[type="text"] {
+            flex: 1;
+        }
+        .todo-meta {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 6px;
+            margin-top: 6px;
+            font-size: 0.8em;
+        }
+        .todo-badge {
+            padding: 2px 8px;
+            border-radius: 10px;
+            background: #eef0fb;
+            color: #667eea;
+        }
+        .todo-badge.priority-high {
+            background: #fde8e8;
+            color: #ef4444;
+        }
+        .todo-badge.priority-low {
+            background: #f0f0f0;
+            color: #888;
+        }
+        .todo-badge.overdue {
+            background: #ef4444;
+            color: white;
+        }
+        .auth-form {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 10px;
+            margin-bottom: 10px;
+        }
+        .auth-form input {
+            flex: 1;
+            padding: 12px;
+            border: 2px solid #e0e0e0;
+            border-radius: 8px;
+            font-size: 1em;
+        }
+        .auth-form button, .auth-user button {
+            padding: 12px 24px;
+            background: #667eea;
+            color: white;
+            border: none;
+            border-radius: 8px;
+            cursor: pointer;
+            font-size: 1em;
+            font-weight: 600;
+        }
+        .auth-form button.secondary, .auth-user button {
+            background: white;
+            color: #667eea;
+            border: 2px solid #667eea;
+        }
+        .auth-user {
+            display: flex;
+            align-items: center;
+            justify-content: space-between;
+            margin-bottom: 20px;
+            color: #555;
+        }
+        .auth-user button {
+            padding: 6px 14px;
+            font-size: 0.9em;
+        }
+        .auth-error {
+            color: #ef4444;
+            font-size: 0.9em;
+            min-height: 1.2em;
+        }
     </style>
 </head>
 <body>
@@ -325,12 +425,39 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
         <img src="/image" alt="Daily random image" class="daily-image">
         <p class="image-caption">Random image from Lorem Picsum (refreshes every 10 minutes)</p>
 
-        <div class="todo-section">
+        <div class="todo-section" id="authSection" style="display: none;">
+            <h2>Log in</h2>
+            <form class="auth-form" onsubmit="login(); return false;">
+                <input type="text" id="usernameInput" placeholder="Username" autocomplete="username">
+                <input type="password" id="passwordInput" placeholder="Password" autocomplete="current-password">
+                <button type="submit">Log in</button>
+                <button type="button" class="secondary" onclick="register()">Register</button>
+            </form>
+            <form class="auth-form" id="oidcForm" style="display: none;" onsubmit="loginWithOIDC(); return false;">
+                <button type="submit" id="oidcButton">Log in with single sign-on</button>
+            </form>
+            <p class="auth-error" id="authError"></p>
+        </div>
+
+        <div class="todo-section" id="todoSection" style="display: none;">
+            <div class="auth-user">
+                <span>Logged in as <strong id="currentUser"></strong></span>
+                <button type="button" onclick="logout()">Log out</button>
+            </div>
             <h2>Create TODO</h2>
             <form class="todo-form" onsubmit="sendTodo(); return false;">
                 <input type="text" id="todoInput" placeholder="Enter a new todo..." maxlength="140" oninput="updateCharCount()">
                 <button type="submit" id="sendBtn">Send</button>
             </form>
+            <div class="todo-details">
+                <input type="date" id="dueInput" title="Due date">
+                <select id="priorityInput" title="Priority">
+                    <option value="low">Low priority</option>
+                    <option value="normal" selected>Normal priority</option>
+                    <option value="high">High priority</option>
+                </select>
+                <input type="text" id="tagsInput" placeholder="Tags, comma separated">
+            </div>
             <p class="char-count" id="charCount">0/140 characters</p>
 
             <h2 style="margin-top: 30px;">TODOs</h2>
@@ -343,23 +470,211 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
     <script>
         const BACKEND_URL = '/api';
 
+        // The session token from POST /auth/login, kept across page loads
+        const TOKEN_KEY = 'todoSessionToken';
+
+        class UnauthorizedError extends Error {}
+
+        // apiFetch calls the backend with the session token. A 401 means the
+        // session expired, so it shows the login form again.
+        async function apiFetch(path, options = {}) {
+            const token = localStorage.getItem(TOKEN_KEY);
+            const headers = Object.assign({}, options.headers);
+            if (token) {
+                headers['Authorization'] = 'Bearer ' + token;
+            }
+            const response = await fetch(BACKEND_URL + path, Object.assign({}, options, { headers }));
+            if (response.status === 401) {
+                showLogin('Your session has expired, please log in again.');
+                throw new UnauthorizedError('Not logged in');
+            }
+            return response;
+        }
+
+        function showLogin(message) {
+            stopTodoEvents();
+            localStorage.removeItem(TOKEN_KEY);
+            document.getElementById('todoSection').style.display = 'none';
+            document.getElementById('authSection').style.display = '';
+            document.getElementById('authError').textContent = message || '';
+        }
+
+        function showTodos(user) {
+            document.getElementById('currentUser').textContent = user.username;
+            document.getElementById('authSection').style.display = 'none';
+            document.getElementById('todoSection').style.display = '';
+            fetchTodos();
+            startTodoEvents();
+        }
+
+        async function login() {
+            const username = document.getElementById('usernameInput').value.trim();
+            const password = document.getElementById('passwordInput').value;
+            try {
+                const response = await fetch(BACKEND_URL + '/auth/login', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ username, password })
+                });
+                if (!response.ok) {
+                    throw new Error((await response.text()).trim() || 'Login failed');
+                }
+                const session = await response.json();
+                localStorage.setItem(TOKEN_KEY, session.token);
+                document.getElementById('passwordInput').value = '';
+                showTodos(session.user);
+            } catch (error) {
+                document.getElementById('authError').textContent = error.message;
+            }
+        }
+
+        async function register() {
+            const username = document.getElementById('usernameInput').value.trim();
+            const password = document.getElementById('passwordInput').value;
+            try {
+                const response = await fetch(BACKEND_URL + '/auth/register', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ username, password })
+                });
+                if (!response.ok) {
+                    throw new Error((await response.text()).trim() || 'Registration failed');
+                }
+                await login();
+            } catch (error) {
+                document.getElementById('authError').textContent = error.message;
+            }
+        }
+
+        function logout() {
+            showLogin();
+        }
+
+        // OpenID Connect login with the authorization code flow and PKCE.
+        // The provider's ID token is sent to the backend like a session
+        // token; the backend checks it against the provider's keys.
+        let oidc = null;
+        const OIDC_LOGIN_KEY = 'oidcLogin';
+
+        async function loadOIDCConfig() {
+            try {
+                const response = await fetch('/oidc-config');
+                const config = await response.json();
+                if (!config.issuer) {
+                    return;
+                }
+                oidc = config;
+                document.getElementById('oidcButton').textContent = 'Log in with ' + config.provider_name;
+                document.getElementById('oidcForm').style.display = '';
+            } catch (error) {
+                console.error('Error loading OIDC config:', error);
+            }
+        }
+
+        async function oidcDiscovery() {
+            const response = await fetch(oidc.issuer.replace(/\/$/, '') + '/.well-known/openid-configuration');
+            if (!response.ok) {
+                throw new Error('Could not reach the login provider');
+            }
+            return response.json();
+        }
+
+        function base64url(bytes) {
+            return btoa(String.fromCharCode(...bytes)).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+        }
+
+        function randomString() {
+            return base64url(crypto.getRandomValues(new Uint8Array(32)));
+        }
+
+        function oidcRedirectURI() {
+            return window.location.origin + '/';
+        }
+
+        async function loginWithOIDC() {
+            try {
+                const discovery = await oidcDiscovery();
+                const login = { verifier: randomString(), state: randomString(), nonce: randomString() };
+                const digest = await crypto.subtle.digest('SHA-256', new TextEncoder().encode(login.verifier));
+                sessionStorage.setItem(OIDC_LOGIN_KEY, JSON.stringify(login));
+
+                const params = new URLSearchParams({
+                    response_type: 'code',
+                    client_id: oidc.client_id,
+                    redirect_uri: oidcRedirectURI(),
+                    scope: oidc.scopes,
+                    state: login.state,
+                    nonce: login.nonce,
+                    code_challenge: base64url(new Uint8Array(digest)),
+                    code_challenge_method: 'S256'
+                });
+                window.location.assign(discovery.authorization_endpoint + '?' + params);
+            } catch (error) {
+                document.getElementById('authError').textContent = error.message;
+            }
+        }
+
+        // completeOIDCLogin exchanges the code the provider redirected back
+        // with for an ID token and stores it as the session token
+        async function completeOIDCLogin(params) {
+            const login = JSON.parse(sessionStorage.getItem(OIDC_LOGIN_KEY) || 'null');
+            sessionStorage.removeItem(OIDC_LOGIN_KEY);
+            // The code is single use, keep it out of the history
+            window.history.replaceState(null, '', '/');
+
+            if (params.get('error')) {
+                throw new Error(params.get('error_description') || params.get('error'));
+            }
+            if (!login || params.get('state') !== login.state) {
+                throw new Error('Login could not be verified, please try again');
+            }
+
+            const discovery = await oidcDiscovery();
+            const response = await fetch(discovery.token_endpoint, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+                body: new URLSearchParams({
+                    grant_type: 'authorization_code',
+                    code: params.get('code'),
+                    redirect_uri: oidcRedirectURI(),
+                    client_id: oidc.client_id,
+                    code_verifier: login.verifier
+                })
+            });
+            if (!response.ok) {
+                throw new Error('Login failed at the provider');
+            }
+            const tokens = await response.json();
+            const payload = tokens.id_token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/');
+            if (JSON.parse(atob(payload)).nonce !== login.nonce) {
+                throw new Error('Login could not be verified, please try again');
+            }
+            localStorage.setItem(TOKEN_KEY, tokens.id_token);
+        }
+
         // Fetch todos from backend
         async function fetchTodos() {
             try {
-                const response = await fetch(BACKEND_URL + '/todos');
+                const response = await apiFetch('/todos');
                 if (!response.ok) {
                     throw new Error('Failed to fetch todos');
                 }
-                const todos = await response.json();
-                renderTodos(todos);
+                todos = await response.json();
+                renderTodos();
             } catch (error) {
+                if (error instanceof UnauthorizedError) {
+                    return;
+                }
                 console.error('Error fetching todos:', error);
                 document.getElementById('todoList').innerHTML = '<li>Error loading todos. Make sure backend is running.</li>';
             }
         }
 
+        // The todos shown, newest first like GET /todos returns them
+        let todos = [];
+
         // Render todos in the UI
-        function renderTodos(todos) {
+        function renderTodos() {
             const todoList = document.getElementById('todoList');
 
             if (todos.length === 0) {
@@ -367,18 +682,176 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
                 return;
             }
 
-            todoList.innerHTML = todos.map(todo => {
-                const checked = todo.done ? 'checked' : '';
-                const completed = todo.done ? 'completed' : '';
-                const checkmark = todo.done ? '✓' : '';
+            todoList.innerHTML = todos.map(renderTodo).join('');
+        }
+
+        function renderTodo(todo) {
+            const checked = todo.done ? 'checked' : '';
+            const completed = todo.done ? 'completed' : '';
+            const checkmark = todo.done ? '✓' : '';
 
-                return ` + "`" + `
-                    <li>
-                        <div class="todo-checkbox ${checked}">${checkmark}</div>
-                        <span class="todo-text ${completed}">${todo.text}</span>
-                    </li>
-                ` + "`" + `;
-            }).join('');
+            // Todos with a url show their text as a link to it
+            let text = escapeHtml(todo.text);
+            if (isHttpUrl(todo.url)) {
+                text = ` + "`" + `<a href="${escapeHtml(todo.url)}" target="_blank" rel="noopener noreferrer">${text}</a>` + "`" + `;
+            }
+            const notes = todo.notes ? ` + "`" + `<span class="todo-notes">${escapeHtml(todo.notes)}</span>` + "`" + ` : '';
+
+            return ` + "`" + `
+                <li data-id="${escapeHtml(todo.id)}">
+                    <div class="todo-checkbox ${checked}">${checkmark}</div>
+                    <span class="todo-text ${completed}">${text}${notes}${renderMeta(todo)}</span>
+                </li>
+            ` + "`" + `;
+        }
+
+        // upsertTodo patches a created or updated todo into the list, and
+        // removeTodo a deleted one, without reloading the rest
+        function upsertTodo(todo) {
+            const index = todos.findIndex(t => t.id === todo.id);
+            if (index >= 0) {
+                todos[index] = todo;
+                const item = document.querySelector('#todoList li[data-id="' + CSS.escape(todo.id) + '"]');
+                if (item) {
+                    item.outerHTML = renderTodo(todo);
+                    return;
+                }
+            } else {
+                todos.unshift(todo);
+                if (todos.length > 1) {
+                    document.getElementById('todoList').insertAdjacentHTML('afterbegin', renderTodo(todo));
+                    return;
+                }
+            }
+            renderTodos();
+        }
+
+        function removeTodo(id) {
+            todos = todos.filter(t => t.id !== id);
+            const item = document.querySelector('#todoList li[data-id="' + CSS.escape(id) + '"]');
+            if (item && todos.length > 0) {
+                item.remove();
+            } else {
+                renderTodos();
+            }
+        }
+
+        // Live updates from GET /todos/events, a Server-Sent Events stream.
+        // It is read with fetch rather than EventSource, which cannot send
+        // the Authorization header. After every (re)connect the list is
+        // fetched again, since changes made while disconnected are not sent.
+        let eventsAbort = null;
+
+        function startTodoEvents() {
+            stopTodoEvents();
+            eventsAbort = new AbortController();
+            streamTodoEvents(eventsAbort.signal);
+        }
+
+        function stopTodoEvents() {
+            if (eventsAbort) {
+                eventsAbort.abort();
+                eventsAbort = null;
+            }
+        }
+
+        async function streamTodoEvents(signal) {
+            let retryDelay = 5000;
+            while (!signal.aborted) {
+                try {
+                    const response = await apiFetch('/todos/events', {
+                        headers: { 'Accept': 'text/event-stream' },
+                        signal
+                    });
+                    if (!response.ok) {
+                        throw new Error('Event stream failed with status ' + response.status);
+                    }
+                    fetchTodos();
+
+                    const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+                    let buffer = '';
+                    for (;;) {
+                        const { value, done } = await reader.read();
+                        if (done) {
+                            break;
+                        }
+                        buffer += value.replace(/\r\n/g, '\n');
+                        let end;
+                        while ((end = buffer.indexOf('\n\n')) >= 0) {
+                            handleTodoEvent(buffer.slice(0, end));
+                            buffer = buffer.slice(end + 2);
+                        }
+                    }
+                } catch (error) {
+                    if (signal.aborted || error instanceof UnauthorizedError) {
+                        return;
+                    }
+                    console.error('Error in todo event stream:', error);
+                }
+                await new Promise(resolve => setTimeout(resolve, retryDelay));
+            }
+        }
+
+        // handleTodoEvent applies one event: its data lines hold the JSON,
+        // comment lines are keep-alives
+        function handleTodoEvent(block) {
+            const data = block.split('\n')
+                .filter(line => line.startsWith('data:'))
+                .map(line => line.slice(5).trim())
+                .join('\n');
+            if (!data) {
+                return;
+            }
+            const event = JSON.parse(data);
+            if (event.type === 'created' || event.type === 'updated') {
+                upsertTodo(event.todo);
+            } else if (event.type === 'deleted') {
+                removeTodo(event.id);
+            } else if (event.type === 'resync') {
+                fetchTodos();
+            }
+        }
+
+        // Priority, due date and tags below the todo text
+        function renderMeta(todo) {
+            const badges = [];
+            if (todo.priority && todo.priority !== 'normal') {
+                badges.push(` + "`" + `<span class="todo-badge priority-${escapeHtml(todo.priority)}">${escapeHtml(todo.priority)} priority</span>` + "`" + `);
+            }
+            if (todo.due_at) {
+                // Dates from the form are stored as midnight UTC, so
+                // compare and show them as UTC days
+                const due = new Date(todo.due_at);
+                const today = new Date().toISOString().slice(0, 10);
+                const overdue = !todo.done && due.toISOString().slice(0, 10) < today ? 'overdue' : '';
+                const dueDate = due.toLocaleDateString(undefined, { timeZone: 'UTC' });
+                badges.push(` + "`" + `<span class="todo-badge ${overdue}">due ${escapeHtml(dueDate)}</span>` + "`" + `);
+            }
+            for (const tag of todo.tags || []) {
+                badges.push(` + "`" + `<span class="todo-badge">#${escapeHtml(tag)}</span>` + "`" + `);
+            }
+            return badges.length ? ` + "`" + `<span class="todo-meta">${badges.join('')}</span>` + "`" + ` : '';
+        }
+
+        function escapeHtml(value) {
+            return String(value)
+                .replace(/&/g, '&amp;')
+                .replace(/</g, '&lt;')
+                .replace(/>/g, '&gt;')
+                .replace(/"/g, '&quot;')
+                .replace(/'/g, '&#39;');
+        }
+
+        function isHttpUrl(value) {
+            if (!value) {
+                return false;
+            }
+            try {
+                const url = new URL(value);
+                return url.protocol === 'http:' || url.protocol === 'https:';
+            } catch (e) {
+                return false;
+            }
         }
 
         function updateCharCount() {
@@ -418,32 +891,81 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
                 return;
             }
 
+            const dueInput = document.getElementById('dueInput');
+            const priorityInput = document.getElementById('priorityInput');
+            const tagsInput = document.getElementById('tagsInput');
+
+            const todo = { text: value, priority: priorityInput.value };
+            if (dueInput.value) {
+                todo.due_at = dueInput.value;
+            }
+            const tags = tagsInput.value.split(',').map(tag => tag.trim()).filter(tag => tag);
+            if (tags.length > 0) {
+                todo.tags = tags;
+            }
+
             try {
-                const response = await fetch(BACKEND_URL + '/todos', {
+                const response = await apiFetch('/todos', {
                     method: 'POST',
                     headers: {
                         'Content-Type': 'application/json',
                     },
-                    body: JSON.stringify({ text: value })
+                    body: JSON.stringify(todo)
                 });
 
                 if (!response.ok) {
-                    throw new Error('Failed to create todo');
+                    // Validation errors, e.g. an invalid tag, are plain text
+                    const message = response.status === 400 ? (await response.text()).trim() : 'Failed to create todo';
+                    throw new Error(message);
                 }
 
-                // Clear input and refresh todos
+                // Clear inputs and show the todo. Its created event will
+                // patch the same entry.
+                upsertTodo(await response.json());
                 input.value = '';
+                dueInput.value = '';
+                priorityInput.value = 'normal';
+                tagsInput.value = '';
                 updateCharCount();
-                fetchTodos();
             } catch (error) {
+                if (error instanceof UnauthorizedError) {
+                    return;
+                }
                 console.error('Error creating todo:', error);
-                alert('Failed to create todo. Please try again.');
+                alert(error.message + '. Please try again.');
             }
         }
 
-        // Load todos when page loads
-        window.onload = function() {
-            fetchTodos();
+        // Load todos when page loads, if still logged in
+        window.onload = async function() {
+            await loadOIDCConfig();
+
+            const params = new URLSearchParams(window.location.search);
+            if (oidc && (params.has('code') || params.has('error'))) {
+                try {
+                    await completeOIDCLogin(params);
+                } catch (error) {
+                    showLogin(error.message);
+                    return;
+                }
+            }
+
+            if (!localStorage.getItem(TOKEN_KEY)) {
+                showLogin();
+                return;
+            }
+            try {
+                const response = await apiFetch('/auth/me');
+                if (!response.ok) {
+                    throw new Error('Failed to fetch the current user');
+                }
+                showTodos(await response.json());
+            } catch (error) {
+                if (!(error instanceof UnauthorizedError)) {
+                    document.getElementById('authSection').style.display = '';
+                    document.getElementById('authError').textContent = 'Error contacting the backend. Make sure it is running.';
+                }
+            }
         };
     </script>
 </body>
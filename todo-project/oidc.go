@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+)
+
+// OIDCConfig tells the browser how to log in with OpenID Connect. It is
+// served at /oidc-config; without an issuer only local accounts are offered.
+type OIDCConfig struct {
+	Issuer       string `json:"issuer,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	Scopes       string `json:"scopes,omitempty"`
+	ProviderName string `json:"provider_name,omitempty"`
+}
+
+var oidcConfig OIDCConfig
+
+func loadOIDCConfig() {
+	oidcConfig.Issuer = os.Getenv("OIDC_ISSUER")
+	if oidcConfig.Issuer == "" {
+		return
+	}
+
+	oidcConfig.ClientID = os.Getenv("OIDC_CLIENT_ID")
+	if oidcConfig.ClientID == "" {
+		log.Printf("Warning: OIDC_ISSUER is set without OIDC_CLIENT_ID, OIDC login disabled")
+		oidcConfig = OIDCConfig{}
+		return
+	}
+
+	oidcConfig.Scopes = os.Getenv("OIDC_SCOPES")
+	if oidcConfig.Scopes == "" {
+		oidcConfig.Scopes = "openid profile email"
+	}
+	oidcConfig.ProviderName = os.Getenv("OIDC_PROVIDER_NAME")
+	if oidcConfig.ProviderName == "" {
+		oidcConfig.ProviderName = "single sign-on"
+	}
+}
+
+func handleOIDCConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(oidcConfig); err != nil {
+		log.Printf("Error encoding OIDC config: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// bitsOf returns the values set in a field's bits.
+func bitsOf(bits uint64) []int {
+	var values []int
+	for v := 0; v < 64; v++ {
+		if bits&(1<<v) != 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func sameInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseCronField(t *testing.T) {
+	minute, dom, month, dow := cronFields[0], cronFields[2], cronFields[3], cronFields[4]
+	for _, tt := range []struct {
+		field string
+		f     cronField
+		want  []int
+	}{
+		{"0", minute, []int{0}},
+		{"59", minute, []int{59}},
+		{"*/15", minute, []int{0, 15, 30, 45}},
+		{"0-30/10", minute, []int{0, 10, 20, 30}},
+		{"5/20", minute, []int{5, 25, 45}},
+		{"1,15,59", minute, []int{1, 15, 59}},
+		{"1-3,10-11", minute, []int{1, 2, 3, 10, 11}},
+		{"58-59/5", minute, []int{58}},
+		{"*", dom, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31}},
+		{"*/10", dom, []int{1, 11, 21, 31}},
+		{"jan,JUL,dec", month, []int{1, 7, 12}},
+		{"mar-may", month, []int{3, 4, 5}},
+		{"*/3", month, []int{1, 4, 7, 10}},
+		{"mon-fri", dow, []int{1, 2, 3, 4, 5}},
+		{"sun", dow, []int{0}},
+		{"7", dow, []int{7}},
+	} {
+		bits, err := parseCronField(tt.field, tt.f)
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.f.name, tt.field, err)
+			continue
+		}
+		if got := bitsOf(bits); !sameInts(got, tt.want) {
+			t.Errorf("%s %q = %v, want %v", tt.f.name, tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleRejectsBadExpressions(t *testing.T) {
+	for expr, want := range map[string]string{
+		"":                "want 5 fields",
+		"* * * *":         "want 5 fields",
+		"* * * * * *":     "want 5 fields",
+		"60 * * * *":      "minute",
+		"* 24 * * *":      "hour",
+		"* * 0 * *":       "day of month",
+		"* * 32 * *":      "day of month",
+		"* * * 13 *":      "month",
+		"* * * * 8":       "day of week",
+		"-1 * * * *":      "minute",
+		"*/0 * * * *":     "invalid step",
+		"*/x * * * *":     "invalid step",
+		"30-10 * * * *":   "invalid range",
+		"1,,2 * * * *":    "minute",
+		"5- * * * *":      "minute",
+		"* * * foo *":     "month",
+		"* * * * monday":  "day of week",
+		"@every 5m":       "want 5 fields",
+		"1.5 * * * *":     "minute",
+		"0 0 * jan-xyz *": "month",
+	} {
+		_, err := ParseSchedule(expr)
+		if err == nil {
+			t.Errorf("%q accepted", expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: error %q, want it to mention %q", expr, err, want)
+		}
+	}
+}
+
+func TestParseScheduleSundayIsZeroAndSeven(t *testing.T) {
+	for _, expr := range []string{"0 0 * * 0", "0 0 * * 7", "0 0 * * sun"} {
+		s, err := ParseSchedule(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 2025-12-06 is a Saturday
+		got := s.Next(time.Date(2025, 12, 6, 12, 0, 0, 0, time.UTC))
+		if want := time.Date(2025, 12, 7, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+			t.Errorf("%q: next = %s, want Sunday %s", expr, got, want)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		parsed, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	for _, tt := range []struct {
+		expr, from, want string
+	}{
+		// Always strictly after from, at the start of a minute
+		{"* * * * *", "2025-12-01 12:00:00", "2025-12-01 12:01:00"},
+		{"* * * * *", "2025-12-01 12:00:59", "2025-12-01 12:01:00"},
+		{"*/15 * * * *", "2025-12-01 12:15:00", "2025-12-01 12:30:00"},
+		{"@hourly", "2025-12-01 12:59:30", "2025-12-01 13:00:00"},
+		{"0 9-17/4 * * *", "2025-12-01 13:00:00", "2025-12-01 17:00:00"},
+		// Rolling over the hour, day, month and year
+		{"0 * * * *", "2025-12-31 23:30:00", "2026-01-01 00:00:00"},
+		{"30 6 * * *", "2025-12-01 07:00:00", "2025-12-02 06:30:00"},
+		{"@monthly", "2025-01-31 12:00:00", "2025-02-01 00:00:00"},
+		{"@yearly", "2025-06-15 00:00:00", "2026-01-01 00:00:00"},
+		{"0 0 31 * *", "2025-04-01 00:00:00", "2025-05-31 00:00:00"},
+		{"0 0 1 jan,jul *", "2025-02-01 00:00:00", "2025-07-01 00:00:00"},
+		// Leap years
+		{"0 0 29 2 *", "2025-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"0 0 29 2 *", "2024-01-15 00:00:00", "2024-02-29 00:00:00"},
+		{"0 0 28 2 *", "2024-02-28 00:00:00", "2025-02-28 00:00:00"},
+		{"0 0 1 3 *", "2024-02-28 12:00:00", "2024-03-01 00:00:00"},
+		// Day of month and day of week: both restricted means either one,
+		// 2025-12-01 is a Monday
+		{"0 0 13 * fri", "2025-12-01 00:00:00", "2025-12-05 00:00:00"},
+		{"0 0 3 * fri", "2025-12-01 00:00:00", "2025-12-03 00:00:00"},
+		// Only one restricted means that one
+		{"0 0 * * fri", "2025-12-01 00:00:00", "2025-12-05 00:00:00"},
+		{"0 0 13 * *", "2025-12-01 00:00:00", "2025-12-13 00:00:00"},
+		// As in cron, a field starting with a star counts as unrestricted,
+		// even with a step, so both must match: the 1st, 11th, 21st or
+		// 31st that is a Friday
+		{"0 0 */10 * fri", "2025-12-01 00:00:00", "2026-05-01 00:00:00"},
+		// A range with a step is restricted, so either one matches
+		{"0 0 1-31/2 * mon", "2025-12-02 00:00:00", "2025-12-03 00:00:00"},
+		{"0 0 13 2 *", "2025-12-01 00:00:00", "2026-02-13 00:00:00"},
+	} {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got.Format(time.DateTime), tt.want)
+		}
+	}
+}
+
+func TestScheduleNextNever(t *testing.T) {
+	for _, expr := range []string{"0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		s, err := ParseSchedule(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Next(time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+			t.Errorf("%q: next = %s, want the zero time", expr, got)
+		}
+	}
+}
+
+func TestScheduleNextKeepsLocation(t *testing.T) {
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		t.Skip(err)
+	}
+	s, _ := ParseSchedule("0 9 * * *")
+	got := s.Next(time.Date(2025, 12, 1, 10, 0, 0, 0, helsinki))
+	if want := time.Date(2025, 12, 2, 9, 0, 0, 0, helsinki); !got.Equal(want) || got.Location() != helsinki {
+		t.Errorf("next = %s, want %s", got, want)
+	}
+}
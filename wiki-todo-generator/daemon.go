@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RunResult records one run in daemon mode.
+type RunResult struct {
+	Trigger    string    `json:"trigger"` // "schedule" or "manual"
+	Slot       string    `json:"slot"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Duration   float64   `json:"duration_seconds"`
+	Created    int       `json:"created"`
+	Result     string    `json:"result"` // "success", "retryable_error" or "permanent_error"
+	Error      string    `json:"error,omitempty"`
+}
+
+// DaemonStatus is served at GET /status.
+type DaemonStatus struct {
+	Schedule string     `json:"schedule"`
+	Running  bool       `json:"running"`
+	NextRun  *time.Time `json:"next_run,omitempty"`
+	LastRun  *RunResult `json:"last_run,omitempty"`
+}
+
+// Daemon runs the generator on a cron schedule instead of once per CronJob
+// pod. Runs never overlap: a scheduled time that passes during a run is
+// skipped, like concurrencyPolicy: Forbid.
+type Daemon struct {
+	config   Config
+	schedule *Schedule
+	runNow   chan struct{}
+
+	mu          sync.Mutex
+	running     bool
+	nextRun     time.Time
+	lastRun     *RunResult
+	lastSuccess time.Time
+	runs        map[string]int
+	created     int
+}
+
+func NewDaemon(config Config) *Daemon {
+	return &Daemon{
+		config:   config,
+		schedule: config.Schedule,
+		runNow:   make(chan struct{}, 1),
+		runs:     map[string]int{"success": 0, "retryable_error": 0, "permanent_error": 0},
+	}
+}
+
+// Start runs the scheduler until ctx is cancelled. The schedule is in UTC,
+// like a CronJob without timeZone.
+func (d *Daemon) Start(ctx context.Context) {
+	for {
+		next := d.schedule.Next(time.Now().UTC())
+		d.mu.Lock()
+		d.nextRun = next
+		d.mu.Unlock()
+
+		// A schedule that never matches only runs on POST /run-now: a nil
+		// channel never receives
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+			fmt.Printf("Next run at %s\n", next.Format(time.RFC3339))
+		}
+
+		select {
+		case <-ctx.Done():
+			stopTimer(timer)
+			return
+		case <-due:
+			d.runOnce(ctx, "schedule", next.Format("2006-01-02T15:04Z"))
+		case <-d.runNow:
+			stopTimer(timer)
+			now := time.Now().UTC()
+			d.runOnce(ctx, "manual", "manual-"+now.Format("2006-01-02T15:04:05Z"))
+		}
+	}
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+func (d *Daemon) runOnce(ctx context.Context, trigger, slot string) {
+	result := &RunResult{Trigger: trigger, Slot: slot, StartedAt: time.Now().UTC()}
+
+	d.mu.Lock()
+	d.running = true
+	d.nextRun = time.Time{}
+	d.mu.Unlock()
+
+	fmt.Printf("Starting %s run %s\n", trigger, slot)
+	config := d.config
+	config.Slot = slot
+	created, err := run(ctx, config)
+
+	result.FinishedAt = time.Now().UTC()
+	result.Duration = result.FinishedAt.Sub(result.StartedAt).Seconds()
+	result.Created = created
+	switch {
+	case err == nil:
+		result.Result = "success"
+	case isPermanent(err):
+		result.Result = "permanent_error"
+		result.Error = err.Error()
+	default:
+		result.Result = "retryable_error"
+		result.Error = err.Error()
+	}
+	if err != nil {
+		log.Printf("Run %s failed (%s): %v", slot, result.Result, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running = false
+	d.lastRun = result
+	d.runs[result.Result]++
+	d.created += created
+	if err == nil {
+		d.lastSuccess = result.FinishedAt
+	}
+}
+
+// Handler serves /healthz, /status, /metrics and POST /run-now.
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", d.handleHealth)
+	mux.HandleFunc("/status", d.handleStatus)
+	mux.HandleFunc("/metrics", d.handleMetrics)
+	mux.HandleFunc("/run-now", d.handleRunNow)
+	return mux
+}
+
+func (d *Daemon) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+func (d *Daemon) status() DaemonStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := DaemonStatus{Schedule: d.schedule.String(), Running: d.running, LastRun: d.lastRun}
+	if !d.nextRun.IsZero() {
+		next := d.nextRun
+		status.NextRun = &next
+	}
+	return status
+}
+
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.status())
+}
+
+// handleRunNow queues a run outside the schedule. It answers 409 if a run is
+// already in progress or queued.
+func (d *Daemon) handleRunNow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	d.mu.Lock()
+	running := d.running
+	d.mu.Unlock()
+	if running {
+		log.Printf("POST /run-now - REJECTED: a run is in progress")
+		http.Error(w, "A run is already in progress", http.StatusConflict)
+		return
+	}
+
+	select {
+	case d.runNow <- struct{}{}:
+		log.Printf("POST /run-now - Run queued")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Run queued\n"))
+	default:
+		log.Printf("POST /run-now - REJECTED: a run is already queued")
+		http.Error(w, "A run is already queued", http.StatusConflict)
+	}
+}
+
+// handleMetrics serves the Prometheus text format.
+func (d *Daemon) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP wiki_todo_generator_runs_total Finished runs by result.")
+	fmt.Fprintln(w, "# TYPE wiki_todo_generator_runs_total counter")
+	for _, result := range []string{"success", "retryable_error", "permanent_error"} {
+		fmt.Fprintf(w, "wiki_todo_generator_runs_total{result=%q} %d\n", result, d.runs[result])
+	}
+
+	fmt.Fprintln(w, "# HELP wiki_todo_generator_todos_created_total Todos created.")
+	fmt.Fprintln(w, "# TYPE wiki_todo_generator_todos_created_total counter")
+	fmt.Fprintf(w, "wiki_todo_generator_todos_created_total %d\n", d.created)
+
+	fmt.Fprintln(w, "# HELP wiki_todo_generator_running Whether a run is in progress.")
+	fmt.Fprintln(w, "# TYPE wiki_todo_generator_running gauge")
+	fmt.Fprintf(w, "wiki_todo_generator_running %d\n", boolToInt(d.running))
+
+	writeTimestamp(w, "wiki_todo_generator_next_run_timestamp_seconds", "Start of the next scheduled run.", d.nextRun)
+	writeTimestamp(w, "wiki_todo_generator_last_success_timestamp_seconds", "End of the last successful run.", d.lastSuccess)
+
+	if d.lastRun != nil {
+		writeTimestamp(w, "wiki_todo_generator_last_run_timestamp_seconds", "End of the last run.", d.lastRun.FinishedAt)
+		fmt.Fprintln(w, "# HELP wiki_todo_generator_last_run_duration_seconds Duration of the last run.")
+		fmt.Fprintln(w, "# TYPE wiki_todo_generator_last_run_duration_seconds gauge")
+		fmt.Fprintf(w, "wiki_todo_generator_last_run_duration_seconds %g\n", d.lastRun.Duration)
+	}
+}
+
+// writeTimestamp writes a gauge in Unix seconds, or nothing for the zero time.
+func writeTimestamp(w http.ResponseWriter, name, help string, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(w, "%s %d\n", name, t.Unix())
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// serveDaemon runs the scheduler and the HTTP server until ctx is cancelled.
+func serveDaemon(ctx context.Context, config Config) error {
+	daemon := NewDaemon(config)
+	server := &http.Server{Addr: ":" + config.Port, Handler: daemon.Handler()}
+
+	done := make(chan struct{})
+	go func() {
+		daemon.Start(ctx)
+		close(done)
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Wiki-todo-generator daemon started on port %s with schedule %q\n", config.Port, config.Schedule)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-done
+	return nil
+}
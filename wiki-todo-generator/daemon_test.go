@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubBackend serves an empty todo list and counts the requests.
+type stubBackend struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newStubBackend(t *testing.T) *stubBackend {
+	b := &stubBackend{}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// newTestDaemon returns a daemon for the schedule whose runs only list the
+// backend's todos.
+func newTestDaemon(t *testing.T, schedule string) (*Daemon, *stubBackend) {
+	t.Helper()
+	s, err := ParseSchedule(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newStubBackend(t)
+	return NewDaemon(Config{BackendURL: backend.URL, Schedule: s, Count: 0, MaxUndone: 10}), backend
+}
+
+// startDaemon runs the scheduler until the test ends.
+func startDaemon(t *testing.T, d *Daemon) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitFor polls until cond holds or a few seconds have passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestDaemonNeverMatchingScheduleOnlyRunsManually(t *testing.T) {
+	// February 30th never comes
+	d, backend := newTestDaemon(t, "0 0 30 2 *")
+	startDaemon(t, d)
+
+	time.Sleep(100 * time.Millisecond)
+	if status := d.status(); status.LastRun != nil || status.NextRun != nil || backend.requests.Load() != 0 {
+		t.Fatalf("status = %+v after %d backend requests, want no run and no next run", status, backend.requests.Load())
+	}
+
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/run-now", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST /run-now: status %d", w.Code)
+	}
+	waitFor(t, "the manual run", func() bool { return d.status().LastRun != nil })
+
+	// Only the one manual run, no busy loop afterwards
+	time.Sleep(100 * time.Millisecond)
+	last := d.status().LastRun
+	if last.Trigger != "manual" || last.Result != "success" {
+		t.Errorf("last run = %+v, want a successful manual run", last)
+	}
+	if n := backend.requests.Load(); n != 1 {
+		t.Errorf("%d backend requests, want 1", n)
+	}
+}
+
+// serve sends a request to the daemon's handler.
+func serve(d *Daemon, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestDaemonHealthz(t *testing.T) {
+	d, _ := newTestDaemon(t, "@hourly")
+	if w := serve(d, "GET", "/healthz"); w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Errorf("GET /healthz = %d %q", w.Code, w.Body)
+	}
+}
+
+func TestDaemonStatus(t *testing.T) {
+	d, _ := newTestDaemon(t, "*/5 * * * *")
+	startDaemon(t, d)
+	waitFor(t, "the next run", func() bool { return d.status().NextRun != nil })
+
+	w := serve(d, "GET", "/status")
+	var status DaemonStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET /status = %d, %v", w.Code, err)
+	}
+	if status.Schedule != "*/5 * * * *" || status.Running || status.LastRun != nil {
+		t.Errorf("status = %+v", status)
+	}
+	if next := *status.NextRun; next.Minute()%5 != 0 || next.Second() != 0 || !next.After(time.Now()) || next.After(time.Now().Add(5*time.Minute)) {
+		t.Errorf("next run = %s, want the next multiple of five minutes", next)
+	}
+
+	if w := serve(d, "POST", "/status"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /status: status %d, want 405", w.Code)
+	}
+
+	// After a run, its result is reported
+	serve(d, "POST", "/run-now")
+	waitFor(t, "the manual run", func() bool { return d.status().LastRun != nil })
+	json.NewDecoder(serve(d, "GET", "/status").Body).Decode(&status)
+	if last := status.LastRun; last == nil || last.Trigger != "manual" || last.Result != "success" || !strings.HasPrefix(last.Slot, "manual-") {
+		t.Errorf("last run = %+v", last)
+	}
+}
+
+func TestDaemonRunNow(t *testing.T) {
+	// Not started, so a queued run stays queued
+	d, _ := newTestDaemon(t, "@hourly")
+
+	if w := serve(d, "GET", "/run-now"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /run-now: status %d, want 405", w.Code)
+	}
+	if w := serve(d, "POST", "/run-now"); w.Code != http.StatusAccepted {
+		t.Errorf("POST /run-now: status %d, want 202", w.Code)
+	}
+	if w := serve(d, "POST", "/run-now"); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "queued") {
+		t.Errorf("POST /run-now while queued = %d %q, want 409", w.Code, w.Body)
+	}
+
+	<-d.runNow
+	d.mu.Lock()
+	d.running = true
+	d.mu.Unlock()
+	if w := serve(d, "POST", "/run-now"); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "in progress") {
+		t.Errorf("POST /run-now while running = %d %q, want 409", w.Code, w.Body)
+	}
+}
+
+func TestDaemonMetrics(t *testing.T) {
+	d, _ := newTestDaemon(t, "@hourly")
+
+	// Before any run, only the counters and the running gauge
+	body := serve(d, "GET", "/metrics").Body.String()
+	for _, want := range []string{
+		`wiki_todo_generator_runs_total{result="success"} 0`,
+		`wiki_todo_generator_runs_total{result="permanent_error"} 0`,
+		"wiki_todo_generator_todos_created_total 0",
+		"wiki_todo_generator_running 0",
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "last_run") || strings.Contains(body, "last_success") {
+		t.Errorf("metrics report a last run before any:\n%s", body)
+	}
+
+	d.runOnce(context.Background(), "manual", "manual-1")
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	d.config.BackendURL = missing.URL
+	d.runOnce(context.Background(), "schedule", "2025-12-01T12:00Z")
+
+	w := serve(d, "GET", "/metrics")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body = w.Body.String()
+	for _, want := range []string{
+		"# TYPE wiki_todo_generator_runs_total counter",
+		`wiki_todo_generator_runs_total{result="success"} 1`,
+		`wiki_todo_generator_runs_total{result="retryable_error"} 0`,
+		`wiki_todo_generator_runs_total{result="permanent_error"} 1`,
+		"# TYPE wiki_todo_generator_last_success_timestamp_seconds gauge",
+		"# TYPE wiki_todo_generator_last_run_duration_seconds gauge",
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+	if last := d.status().LastRun; last.Result != "permanent_error" || last.Error == "" {
+		t.Errorf("last run = %+v, want the permanent error", last)
+	}
+}
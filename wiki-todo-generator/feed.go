@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// feedDocument covers both RSS 2.0 (<rss><channel><item>) and Atom
+// (<feed><entry>); only one of Items and Entries is filled.
+type feedDocument struct {
+	Items []struct {
+		Title string `xml:"title"`
+		Link  string `xml:"link"`
+	} `xml:"channel>item"`
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// fetchFeed returns the items of the RSS or Atom feed at feedURL.
+func fetchFeed(ctx context.Context, feedURL string) ([]Suggestion, error) {
+	resp, err := doRequest(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", feedURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", userAgent)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
+
+	var doc feedDocument
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse feed %s: %w", feedURL, err)
+	}
+
+	var items []Suggestion
+	for _, item := range doc.Items {
+		items = append(items, Suggestion{Title: strings.TrimSpace(item.Title), URL: strings.TrimSpace(item.Link)})
+	}
+	for _, entry := range doc.Entries {
+		s := Suggestion{Title: strings.TrimSpace(entry.Title)}
+		for _, link := range entry.Links {
+			// The entry's own page is rel="alternate", which is also the default
+			if link.Rel == "" || link.Rel == "alternate" {
+				s.URL = link.Href
+				break
+			}
+		}
+		items = append(items, s)
+	}
+	return items, nil
+}
+
+// randomFeedItem returns a random item with a link from the feed at feedURL.
+func randomFeedItem(ctx context.Context, feedURL string) (Suggestion, error) {
+	items, err := fetchFeed(ctx, feedURL)
+	if err != nil {
+		return Suggestion{}, err
+	}
+
+	var linked []Suggestion
+	for _, item := range items {
+		if item.URL != "" {
+			linked = append(linked, item)
+		}
+	}
+	if len(linked) == 0 {
+		return Suggestion{}, permanent(fmt.Errorf("no items with links in feed %s", feedURL))
+	}
+	return linked[rand.Intn(len(linked))], nil
+}
@@ -2,116 +2,303 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type TodoRequest struct {
-	Text string `json:"text"`
+	Text  string `json:"text"`
+	URL   string `json:"url,omitempty"`
+	Notes string `json:"notes,omitempty"`
+}
+
+// Limits enforced by todo-backend
+const (
+	maxTextLength  = 140
+	maxNotesLength = 1000
+)
+
+// maxCount is the most todos one run may create.
+const maxCount = 50
+
+// Config holds the settings for one run.
+type Config struct {
+	BackendURL  string
+	APIToken    string
+	Sources     *Sources
+	Count       int
+	MaxUndone   int
+	MaxAttempts int
+	Slot        string
+	Schedule    *Schedule
+	Port        string
+	HTTPTimeout time.Duration
+	Retry       RetryPolicy
+	DryRun      bool
 }
 
 func main() {
-	backendURL := os.Getenv("BACKEND_URL")
-	if backendURL == "" {
-		backendURL = "http://todo-backend-svc:2345/todos"
-	}
+	dryRun := flag.Bool("dry-run", false, "print the todo instead of posting it")
+	daemon := flag.Bool("daemon", false, "keep running and create todos on SCHEDULE instead of once")
+	flag.Parse()
 
-	// Get random Wikipedia article URL by following redirect
-	wikiURL, err := getRandomWikipediaURL()
+	config, err := loadConfig()
 	if err != nil {
-		log.Fatalf("Failed to get random Wikipedia URL: %v", err)
+		log.Printf("Invalid configuration:\n%v", err)
+		os.Exit(exitPermanent)
 	}
+	config.DryRun = *dryRun
 
-	fmt.Printf("Random Wikipedia article: %s\n", wikiURL)
-
-	// Create todo text
-	todoText := fmt.Sprintf("Read %s", wikiURL)
+	httpClient.Timeout = config.HTTPTimeout
+	retryPolicy = config.Retry
+	backendToken = config.APIToken
 
-	// Send todo to backend
-	if err := createTodo(backendURL, todoText); err != nil {
-		log.Fatalf("Failed to create todo: %v", err)
+	if *daemon {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := serveDaemon(ctx, config); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	fmt.Printf("Successfully created todo: %s\n", todoText)
+	if _, err := run(context.Background(), config); err != nil {
+		code := exitCode(err)
+		if code == exitPermanent {
+			log.Printf("Failed permanently, not worth retrying (exit code %d): %v", code, err)
+		} else {
+			log.Printf("Failed, retry later (exit code %d): %v", code, err)
+		}
+		os.Exit(code)
+	}
 }
 
-type WikiAPIResponse struct {
-	Query struct {
-		Random []struct {
-			ID    int    `json:"id"`
-			Title string `json:"title"`
-		} `json:"random"`
-	} `json:"query"`
-}
+// loadConfig reads the configuration from the environment. All invalid
+// values are reported together.
+func loadConfig() (Config, error) {
+	var errs []error
+	config := Config{}
+
+	config.BackendURL = os.Getenv("BACKEND_URL")
+	if config.BackendURL == "" {
+		config.BackendURL = "http://todo-backend-svc:2345/todos"
+	}
+	if u, err := url.Parse(config.BackendURL); err != nil || u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid BACKEND_URL %q: must be an absolute URL", config.BackendURL))
+	}
 
-func getRandomWikipediaURL() (string, error) {
-	// Use Wikipedia API to get a random article
-	apiURL := "https://en.wikipedia.org/w/api.php?action=query&format=json&list=random&rnnamespace=0&rnlimit=1"
+	// An API token of the backend user the todos are created for, from
+	// POST /auth/tokens
+	config.APIToken = strings.TrimSpace(os.Getenv("TODO_API_TOKEN"))
+	if config.APIToken == "" {
+		log.Printf("TODO_API_TOKEN is not set, the backend will reject requests if it requires login")
+	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", apiURL, nil)
+	wikiLang := os.Getenv("WIKI_LANG")
+	if wikiLang == "" {
+		wikiLang = "en"
+	}
+	wiki, err := NewWiki(wikiLang, os.Getenv("WIKI_API_URL"), os.Getenv("WIKI_REST_URL"))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		errs = append(errs, err)
+	} else if config.Sources, err = loadSources(os.Getenv("SOURCES_CONFIG"), wiki); err != nil {
+		errs = append(errs, err)
 	}
 
-	// Set User-Agent as required by Wikipedia
-	req.Header.Set("User-Agent", "WikiTodoGenerator/1.0 (Kubernetes CronJob)")
+	if config.Count, err = envInt("COUNT", 1); err != nil {
+		errs = append(errs, err)
+	} else if config.Count < 1 || config.Count > maxCount {
+		errs = append(errs, fmt.Errorf("invalid COUNT %d: must be between 1 and %d", config.Count, maxCount))
+	}
+	if config.MaxUndone, err = envInt("MAX_UNDONE_WIKI_TODOS", 10); err != nil {
+		errs = append(errs, err)
+	}
+	if config.MaxAttempts, err = envInt("MAX_ATTEMPTS", 5); err != nil {
+		errs = append(errs, err)
+	}
+	if config.HTTPTimeout, err = envDuration("HTTP_TIMEOUT", 10*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if config.Retry.Retries, err = envInt("HTTP_RETRIES", 3); err != nil {
+		errs = append(errs, err)
+	}
+	if config.Retry.Backoff, err = envDuration("HTTP_RETRY_BACKOFF", 500*time.Millisecond); err != nil {
+		errs = append(errs, err)
+	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to request random article: %w", err)
+	// The slot makes Idempotency-Keys differ between scheduled runs but not
+	// between retries of one run. The CronJob sets it to the Job name.
+	config.Slot = os.Getenv("SCHEDULE_SLOT")
+	if config.Slot == "" {
+		config.Slot = time.Now().UTC().Truncate(time.Hour).Format("2006-01-02T15Z")
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	// Only used with --daemon
+	schedule := os.Getenv("SCHEDULE")
+	if schedule == "" {
+		schedule = "0 * * * *"
+	}
+	if config.Schedule, err = ParseSchedule(schedule); err != nil {
+		errs = append(errs, err)
+	}
+	config.Port = os.Getenv("PORT")
+	if config.Port == "" {
+		config.Port = "8080"
 	}
 
-	var apiResp WikiAPIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return "", fmt.Errorf("failed to parse JSON: %w", err)
+	return config, errors.Join(errs...)
+}
+
+// run creates up to config.Count todos and returns how many it created.
+// Errors are permanent (see isPermanent) when running again would not help.
+func run(ctx context.Context, config Config) (int, error) {
+	// Check what is already in the list before adding anything
+	todos, err := getTodos(ctx, config.BackendURL)
+	if err != nil {
+		if !config.DryRun {
+			return 0, fmt.Errorf("failed to get existing todos: %w", err)
+		}
+		fmt.Printf("Dry run: cannot get existing todos, not deduplicating: %v\n", err)
 	}
 
-	if len(apiResp.Query.Random) == 0 {
-		return "", fmt.Errorf("no random article found")
+	existing := existingTodos(todos)
+	undone := undoneReadTodos(todos)
+	fmt.Printf("Found %d todos, %d undone reading todos\n", len(todos), undone)
+
+	if undone > config.MaxUndone {
+		fmt.Printf("Skipping: %d undone reading todos is more than MAX_UNDONE_WIKI_TODOS=%d\n", undone, config.MaxUndone)
+		return 0, nil
 	}
 
-	title := apiResp.Query.Random[0].Title
-	// URL encode the title by replacing spaces with underscores
-	// Wikipedia uses underscores in URLs
-	encodedTitle := ""
-	for _, r := range title {
-		if r == ' ' {
-			encodedTitle += "_"
-		} else {
-			encodedTitle += string(r)
+	created := 0
+	for attempt := 1; created < config.Count && attempt <= config.MaxAttempts; attempt++ {
+		source := config.Sources.Pick()
+		suggestions, err := nextSuggestions(ctx, source, config.Count-created)
+		if err != nil {
+			return created, fmt.Errorf("failed to get a todo from %s: %w", source.Name(), err)
+		}
+
+		for _, suggestion := range suggestions {
+			if created == config.Count {
+				break
+			}
+
+			todo := suggestion.TodoRequest()
+			fmt.Printf("Suggestion from %s: %s %s\n", source.Name(), todo.Text, todo.URL)
+
+			if existing[suggestion.Key()] {
+				fmt.Printf("Skipping %q: already in the todo list (attempt %d/%d)\n", todo.Text, attempt, config.MaxAttempts)
+				continue
+			}
+			existing[suggestion.Key()] = true
+
+			key := idempotencyKey(config.Slot, suggestion)
+
+			if config.DryRun {
+				body, _ := json.MarshalIndent(todo, "", "  ")
+				fmt.Printf("Dry run: would POST to %s with Idempotency-Key %s:\n%s\n", config.BackendURL, key, body)
+				created++
+				continue
+			}
+
+			// Send todo to backend
+			replayed, err := createTodo(ctx, config.BackendURL, key, todo)
+			if err != nil {
+				return created, fmt.Errorf("failed to create todo %q after creating %d: %w", todo.Text, created, err)
+			}
+
+			if replayed {
+				fmt.Printf("Todo already created by an earlier attempt of this run: %s\n", todo.Text)
+			} else {
+				fmt.Printf("Successfully created todo: %s\n", todo.Text)
+			}
+			created++
 		}
 	}
 
-	return fmt.Sprintf("https://en.wikipedia.org/wiki/%s", encodedTitle), nil
+	if created < config.Count {
+		fmt.Printf("Created %d of %d todos: the remaining suggestions were already in the todo list\n", created, config.Count)
+	} else if config.Count > 1 {
+		fmt.Printf("Created %d todos\n", created)
+	}
+	return created, nil
+}
+
+// idempotencyKey is sent with each todo, so the backend creates it only
+// once per slot even if the POST or the whole Job is retried.
+func idempotencyKey(slot string, suggestion Suggestion) string {
+	key := "wiki-todo-generator:" + slot + ":" + suggestion.IdempotencyID()
+	if len(key) > 255 {
+		// Long URLs or prompts are hashed to fit the backend's limit
+		key = fmt.Sprintf("wiki-todo-generator:%s:%x", slot, sha256.Sum256([]byte(suggestion.IdempotencyID())))
+	}
+	return key
 }
 
-func createTodo(backendURL, text string) error {
-	todoReq := TodoRequest{Text: text}
+// envInt reads a non-negative integer environment variable.
+func envInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a non-negative integer", name, value)
+	}
+	return n, nil
+}
+
+// envDuration reads a positive duration environment variable such as 10s.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive duration such as 10s", name, value)
+	}
+	return d, nil
+}
+
+// createTodo posts the todo with an Idempotency-Key. replayed reports that
+// the backend had already created it for this key.
+func createTodo(ctx context.Context, backendURL, idempotencyKey string, todoReq TodoRequest) (replayed bool, err error) {
 	jsonData, err := json.Marshal(todoReq)
 	if err != nil {
-		return fmt.Errorf("failed to marshal JSON: %w", err)
+		return false, permanent(fmt.Errorf("failed to marshal JSON: %w", err))
 	}
 
-	resp, err := http.Post(backendURL, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := doRequest(ctx, func() (*http.Request, error) {
+		req, err := newBackendRequest("POST", backendURL, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+		return req, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return false, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return false, unexpectedStatus(resp)
 	}
 
-	return nil
+	return resp.Header.Get("Idempotent-Replayed") == "true", nil
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Exit codes, from sysexits.h. The CronJob's pod failure policy fails the
+// Job on exitPermanent instead of retrying.
+const (
+	exitRetryable = 75 // EX_TEMPFAIL: a source or the backend is down
+	exitPermanent = 78 // EX_CONFIG: bad configuration or a rejected request
+)
+
+// permanentError marks failures that retrying will not fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// exitCode maps an error from a run to the process exit code.
+func exitCode(err error) int {
+	if isPermanent(err) {
+		return exitPermanent
+	}
+	return exitRetryable
+}
+
+// httpClient is shared by all requests so HTTP_TIMEOUT applies everywhere.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// RetryPolicy controls retries of network errors and 5xx responses.
+type RetryPolicy struct {
+	Retries int
+	Backoff time.Duration
+}
+
+var retryPolicy = RetryPolicy{Retries: 3, Backoff: 500 * time.Millisecond}
+
+// doRequest sends the request built by newRequest, retrying network errors,
+// 5xx, 408 and 429 responses with jittered exponential backoff. newRequest is
+// called for every attempt so request bodies can be sent again. Other
+// responses are returned as they are.
+func doRequest(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt <= retryPolicy.Retries; attempt++ {
+		if attempt > 0 {
+			// Full jitter: a random wait up to Backoff * 2^(attempt-1)
+			wait := time.Duration(rand.Int63n(int64(retryPolicy.Backoff<<(attempt-1)) + 1))
+			fmt.Printf("Retrying in %s (retry %d/%d): %v\n", wait.Round(time.Millisecond), attempt, retryPolicy.Retries, lastErr)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, permanent(fmt.Errorf("failed to create request: %w", err))
+		}
+		req = req.WithContext(ctx)
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("%s %s: %w", req.Method, req.URL, err)
+			continue
+		}
+		if !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		lastErr = fmt.Errorf("%s %s: unexpected status code: %d", req.Method, req.URL, resp.StatusCode)
+	}
+	return nil, lastErr
+}
+
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// unexpectedStatus reports a response that is neither successful nor worth
+// retrying, such as a 400 from the backend or a 404 from the API.
+func unexpectedStatus(resp *http.Response) error {
+	err := fmt.Errorf("%s %s: unexpected status code: %d", resp.Request.Method, resp.Request.URL, resp.StatusCode)
+	if retryableStatus(resp.StatusCode) {
+		return err
+	}
+	return permanent(err)
+}
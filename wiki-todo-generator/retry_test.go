@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useRetryPolicy sets the retry policy until the test ends.
+func useRetryPolicy(t *testing.T, policy RetryPolicy) {
+	old := retryPolicy
+	retryPolicy = policy
+	t.Cleanup(func() { retryPolicy = old })
+}
+
+// flakyServer answers with the statuses in order, then 200 with the
+// request body echoed back.
+type flakyServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	bodies   []string
+}
+
+func newFlakyServer(t *testing.T, statuses ...int) *flakyServer {
+	s := &flakyServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.bodies = append(s.bodies, string(body))
+		status := http.StatusOK
+		if s.requests < len(s.statuses) {
+			status = s.statuses[s.requests]
+		}
+		s.requests++
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *flakyServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *flakyServer) post(ctx context.Context, body string) (*http.Response, error) {
+	return doRequest(ctx, func() (*http.Request, error) {
+		return http.NewRequest("POST", s.URL, strings.NewReader(body))
+	})
+}
+
+func TestDoRequestRetriesUntilSuccess(t *testing.T) {
+	useRetryPolicy(t, RetryPolicy{Retries: 3, Backoff: time.Millisecond})
+	server := newFlakyServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusRequestTimeout)
+
+	resp, err := server.post(context.Background(), `{"text": "todo"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || server.count() != 4 {
+		t.Errorf("status %d after %d requests, want 200 after 4", resp.StatusCode, server.count())
+	}
+	// The body is sent again on every attempt
+	for i, body := range server.bodies {
+		if body != `{"text": "todo"}` {
+			t.Errorf("attempt %d sent %q", i+1, body)
+		}
+	}
+}
+
+func TestDoRequestGivesUp(t *testing.T) {
+	useRetryPolicy(t, RetryPolicy{Retries: 2, Backoff: time.Millisecond})
+	server := newFlakyServer(t, 500, 502, 503, 504)
+
+	_, err := server.post(context.Background(), "")
+	if err == nil || !strings.Contains(err.Error(), "unexpected status code: 503") {
+		t.Fatalf("err = %v, want the last status", err)
+	}
+	if isPermanent(err) {
+		t.Error("5xx after all retries is permanent, want retryable")
+	}
+	if server.count() != 3 {
+		t.Errorf("%d requests, want 1 plus 2 retries", server.count())
+	}
+}
+
+func TestDoRequestDoesNotRetryClientErrors(t *testing.T) {
+	useRetryPolicy(t, RetryPolicy{Retries: 3, Backoff: time.Millisecond})
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound} {
+		server := newFlakyServer(t, status)
+
+		resp, err := server.post(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status || server.count() != 1 {
+			t.Errorf("%d: got %d after %d requests, want it returned after 1", status, resp.StatusCode, server.count())
+		}
+		if err := unexpectedStatus(resp); !isPermanent(err) {
+			t.Errorf("%d: unexpectedStatus is not permanent: %v", status, err)
+		}
+	}
+}
+
+func TestDoRequestRetriesNetworkErrors(t *testing.T) {
+	useRetryPolicy(t, RetryPolicy{Retries: 2, Backoff: time.Millisecond})
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	attempts := 0
+	_, err := doRequest(context.Background(), func() (*http.Request, error) {
+		attempts++
+		return http.NewRequest("GET", server.URL, nil)
+	})
+	if err == nil || isPermanent(err) {
+		t.Errorf("err = %v, want a retryable error", err)
+	}
+	if attempts != 3 {
+		t.Errorf("%d attempts, want 3", attempts)
+	}
+}
+
+func TestDoRequestBackoff(t *testing.T) {
+	// Full jitter waits at most 20ms + 40ms + 80ms over three retries
+	useRetryPolicy(t, RetryPolicy{Retries: 3, Backoff: 20 * time.Millisecond})
+	server := newFlakyServer(t, 503, 503, 503)
+
+	start := time.Now()
+	resp, err := server.post(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed > 140*time.Millisecond+time.Second {
+		t.Errorf("three retries took %v, want at most 140ms of backoff", elapsed)
+	}
+}
+
+func TestDoRequestStopsWhenCancelled(t *testing.T) {
+	useRetryPolicy(t, RetryPolicy{Retries: 3, Backoff: time.Hour})
+	server := newFlakyServer(t, 503)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := server.post(ctx, "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelled backoff returned after %v", elapsed)
+	}
+	if server.count() != 1 {
+		t.Errorf("%d requests, want 1", server.count())
+	}
+}
+
+func TestDoRequestBadRequestIsPermanent(t *testing.T) {
+	_, err := doRequest(context.Background(), func() (*http.Request, error) {
+		return http.NewRequest("GET", "://not a url", nil)
+	})
+	if !isPermanent(err) {
+		t.Errorf("err = %v, want a permanent error", err)
+	}
+}
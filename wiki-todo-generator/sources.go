@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Suggestion is something to read, proposed by a TodoSource. ID is a stable
+// identifier such as the Wikipedia page ID, if the source has one.
+type Suggestion struct {
+	ID      string
+	Title   string
+	URL     string
+	Summary string
+}
+
+// TodoRequest is the todo created for the suggestion: the title as text,
+// with the link and summary in their own fields. The text falls back to the
+// URL when there is no title. Both are cut to the backend's limits.
+func (s Suggestion) TodoRequest() TodoRequest {
+	text := s.Title
+	if text == "" {
+		text = s.URL
+	}
+	return TodoRequest{
+		Text:  truncate(text, maxTextLength),
+		URL:   s.URL,
+		Notes: truncate(s.Summary, maxNotesLength),
+	}
+}
+
+// Key identifies the suggestion for deduplication, see todoKey.
+func (s Suggestion) Key() string {
+	if s.URL != "" {
+		return "url:" + normalizeArticleURL(s.URL)
+	}
+	return "text:" + strings.TrimSpace(s.Title)
+}
+
+// IdempotencyID identifies the suggestion in Idempotency-Key headers: its
+// ID if it has one, otherwise its deduplication key.
+func (s Suggestion) IdempotencyID() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return s.Key()
+}
+
+// truncate cuts s to at most max bytes at a rune boundary, ending with an
+// ellipsis when anything was cut.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	const ellipsis = "…"
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return strings.TrimSpace(s[:cut]) + ellipsis
+}
+
+// TodoSource proposes todos.
+type TodoSource interface {
+	Name() string
+	Next(ctx context.Context) (Suggestion, error)
+}
+
+// BatchSource is a TodoSource that can propose several todos in one request.
+type BatchSource interface {
+	TodoSource
+	NextN(ctx context.Context, n int) ([]Suggestion, error)
+}
+
+// nextSuggestions asks source for up to n suggestions, in one request if the
+// source supports batches.
+func nextSuggestions(ctx context.Context, source TodoSource, n int) ([]Suggestion, error) {
+	if batch, ok := source.(BatchSource); ok && n > 1 {
+		return batch.NextN(ctx, n)
+	}
+	suggestion, err := source.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []Suggestion{suggestion}, nil
+}
+
+// SourceConfig declares one source and its weight. Type selects the source:
+//
+//	wikipedia-random   - random article
+//	wikipedia-category - random article from Category
+//	wikipedia-featured - featured article of the day
+//	feed               - random item from the RSS or Atom feed at URL
+//	file               - random line from the text file at Path
+//
+// Sources are picked at random in proportion to Weight (default 1).
+type SourceConfig struct {
+	Type     string `json:"type"`
+	Weight   int    `json:"weight,omitempty"`
+	Category string `json:"category,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Path     string `json:"path,omitempty"`
+}
+
+type SourcesConfig struct {
+	Sources []SourceConfig `json:"sources"`
+}
+
+type weightedSource struct {
+	source TodoSource
+	weight int
+}
+
+// Sources picks one of several sources at random, by weight.
+type Sources struct {
+	sources []weightedSource
+	total   int
+}
+
+// loadSources reads the JSON sources config at path, or returns the
+// Wikipedia random source when path is empty.
+func loadSources(path string, wiki *Wiki) (*Sources, error) {
+	configs := []SourceConfig{{Type: "wikipedia-random"}}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var config SourcesConfig
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("invalid sources config %s: %w", path, err)
+		}
+		if len(config.Sources) == 0 {
+			return nil, fmt.Errorf("invalid sources config %s: no sources", path)
+		}
+		configs = config.Sources
+	}
+
+	sources := &Sources{}
+	var errs []error
+	for i, c := range configs {
+		source, err := newSource(c, wiki)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("source %d (%s): %w", i, c.Type, err))
+			continue
+		}
+		if c.Weight == 0 {
+			c.Weight = 1
+		}
+		if c.Weight < 0 {
+			errs = append(errs, fmt.Errorf("source %d (%s): weight must not be negative", i, c.Type))
+			continue
+		}
+		sources.sources = append(sources.sources, weightedSource{source, c.Weight})
+		sources.total += c.Weight
+	}
+	return sources, errors.Join(errs...)
+}
+
+func newSource(c SourceConfig, wiki *Wiki) (TodoSource, error) {
+	switch c.Type {
+	case "wikipedia-random":
+		return wikiRandomSource{wiki}, nil
+	case "wikipedia-category":
+		if c.Category == "" {
+			return nil, errors.New("category is required")
+		}
+		return wikiCategorySource{wiki, c.Category}, nil
+	case "wikipedia-featured":
+		return wikiFeaturedSource{wiki}, nil
+	case "feed":
+		if c.URL == "" {
+			return nil, errors.New("url is required")
+		}
+		return feedSource{c.URL}, nil
+	case "file":
+		if c.Path == "" {
+			return nil, errors.New("path is required")
+		}
+		return fileSource{c.Path}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q (want wikipedia-random, wikipedia-category, wikipedia-featured, feed or file)", c.Type)
+}
+
+// Pick returns a random source, weighted.
+func (s *Sources) Pick() TodoSource {
+	n := rand.Intn(s.total)
+	for _, ws := range s.sources {
+		if n < ws.weight {
+			return ws.source
+		}
+		n -= ws.weight
+	}
+	return s.sources[len(s.sources)-1].source
+}
+
+type wikiRandomSource struct{ wiki *Wiki }
+
+func (s wikiRandomSource) Name() string { return "wikipedia-random" }
+
+func (s wikiRandomSource) Next(ctx context.Context) (Suggestion, error) {
+	articles, err := s.NextN(ctx, 1)
+	if err != nil {
+		return Suggestion{}, err
+	}
+	return articles[0], nil
+}
+
+func (s wikiRandomSource) NextN(ctx context.Context, n int) ([]Suggestion, error) {
+	articles, err := s.wiki.RandomArticles(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	for i := range articles {
+		articles[i] = s.wiki.WithSummary(ctx, articles[i])
+	}
+	return articles, nil
+}
+
+type wikiCategorySource struct {
+	wiki     *Wiki
+	category string
+}
+
+func (s wikiCategorySource) Name() string { return "wikipedia-category:" + s.category }
+
+func (s wikiCategorySource) Next(ctx context.Context) (Suggestion, error) {
+	article, err := s.wiki.CategoryArticle(ctx, s.category)
+	if err != nil {
+		return article, err
+	}
+	return s.wiki.WithSummary(ctx, article), nil
+}
+
+type wikiFeaturedSource struct{ wiki *Wiki }
+
+func (s wikiFeaturedSource) Name() string { return "wikipedia-featured" }
+
+func (s wikiFeaturedSource) Next(ctx context.Context) (Suggestion, error) {
+	return s.wiki.FeaturedArticle(ctx, time.Now().UTC())
+}
+
+type feedSource struct{ url string }
+
+func (s feedSource) Name() string { return "feed:" + s.url }
+
+func (s feedSource) Next(ctx context.Context) (Suggestion, error) {
+	return randomFeedItem(ctx, s.url)
+}
+
+// fileSource reads prompts from a text file, one per line. Blank lines and
+// lines starting with # are ignored. A line that is a URL becomes a todo
+// with that link; anything else is used as the todo text.
+type fileSource struct{ path string }
+
+func (s fileSource) Name() string { return "file:" + s.path }
+
+func (s fileSource) Next(ctx context.Context) (Suggestion, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return Suggestion{}, permanent(err)
+	}
+	defer file.Close()
+
+	var prompts []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prompts = append(prompts, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return Suggestion{}, permanent(err)
+	}
+	if len(prompts) == 0 {
+		return Suggestion{}, permanent(fmt.Errorf("no prompts in %s", s.path))
+	}
+
+	prompt := prompts[rand.Intn(len(prompts))]
+	if strings.HasPrefix(prompt, "https://") || strings.HasPrefix(prompt, "http://") {
+		return Suggestion{URL: prompt}, nil
+	}
+	return Suggestion{Title: prompt}, nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const rssFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>Example blog</title>
+    <link>https://blog.example.com/</link>
+    <item>
+      <title>  Announcing &amp; explaining  </title>
+      <link> https://blog.example.com/announcing?utm=rss&amp;x=1 </link>
+    </item>
+    <item>
+      <title>An item without a link</title>
+    </item>
+  </channel>
+</rss>`
+
+const atomFixture = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example Atom feed</title>
+  <link rel="self" href="https://atom.example.com/feed.atom"/>
+  <entry>
+    <title>Käärijä on tour</title>
+    <link rel="self" href="https://atom.example.com/entries/1.atom"/>
+    <link rel="alternate" href="https://atom.example.com/2025/tour"/>
+  </entry>
+  <entry>
+    <title>Default rel</title>
+    <link href="https://atom.example.com/2025/default"/>
+  </entry>
+  <entry>
+    <title>Only a self link</title>
+    <link rel="self" href="https://atom.example.com/entries/3.atom"/>
+  </entry>
+</feed>`
+
+// serveFixture serves body with the content type at every path.
+func serveFixture(t *testing.T, contentType, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("%s sent User-Agent %q", r.URL, r.Header.Get("User-Agent"))
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestSource builds a source from its config, as loadSources does.
+func newTestSource(t *testing.T, c SourceConfig, wiki *Wiki) TodoSource {
+	t.Helper()
+	source, err := newSource(c, wiki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestWikipediaRandomSource(t *testing.T) {
+	stub := newStubWiki(t)
+	source := newTestSource(t, SourceConfig{Type: "wikipedia-random"}, stub.wiki(t, "fi"))
+
+	suggestions, err := nextSuggestions(context.Background(), source, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stub.lastQuery().Get("grnlimit"); got != "3" {
+		t.Errorf("asked for %s articles in one batch, want 3", got)
+	}
+	// The stub always returns all its articles; each gets its summary
+	if len(suggestions) != len(stubArticles) {
+		t.Fatalf("got %d suggestions, want %d", len(suggestions), len(stubArticles))
+	}
+	if s := suggestions[0]; s.Title != "What?" || s.URL != "https://fi.wikipedia.org/wiki/What%3F" || s.Summary != "A question." {
+		t.Errorf("first suggestion = %+v", s)
+	}
+}
+
+func TestWikipediaCategorySource(t *testing.T) {
+	stub := newStubWiki(t)
+	source := newTestSource(t, SourceConfig{Type: "wikipedia-category", Category: "Music"}, stub.wiki(t, "fi"))
+
+	s, err := source.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "Käärijä" || s.URL != "https://fi.wikipedia.org/wiki/K%C3%A4%C3%A4rij%C3%A4" || s.Summary != "A singer." || s.ID != "fi.wikipedia.org/5" {
+		t.Errorf("suggestion = %+v", s)
+	}
+	if source.Name() != "wikipedia-category:Music" {
+		t.Errorf("name = %q", source.Name())
+	}
+}
+
+func TestWikipediaFeaturedSource(t *testing.T) {
+	stub := newStubWiki(t)
+	// Today in UTC, and tomorrow in case the test runs over midnight
+	now := time.Now().UTC()
+	stub.featured[now.Format("2006/01/02")] = stubArticles[2]
+	stub.featured[now.AddDate(0, 0, 1).Format("2006/01/02")] = stubArticles[2]
+	source := newTestSource(t, SourceConfig{Type: "wikipedia-featured"}, stub.wiki(t, "fi"))
+
+	s, err := source.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "100% Orange Juice" || s.URL != "https://fi.wikipedia.org/wiki/100%25_Orange_Juice" || s.Summary != "A game." {
+		t.Errorf("suggestion = %+v", s)
+	}
+}
+
+func TestFeedSource(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		body        string
+		want        []Suggestion
+	}{
+		{"rss", "application/rss+xml", rssFixture, []Suggestion{
+			{Title: "Announcing & explaining", URL: "https://blog.example.com/announcing?utm=rss&x=1"},
+			{Title: "An item without a link"},
+		}},
+		{"atom", "application/atom+xml", atomFixture, []Suggestion{
+			{Title: "Käärijä on tour", URL: "https://atom.example.com/2025/tour"},
+			{Title: "Default rel", URL: "https://atom.example.com/2025/default"},
+			{Title: "Only a self link"},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := serveFixture(t, tt.contentType, tt.body)
+
+			items, err := fetchFeed(context.Background(), server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != len(tt.want) {
+				t.Fatalf("items = %+v, want %+v", items, tt.want)
+			}
+			for i := range items {
+				if items[i] != tt.want[i] {
+					t.Errorf("item %d = %+v, want %+v", i, items[i], tt.want[i])
+				}
+			}
+
+			// The source only picks items with links
+			source := newTestSource(t, SourceConfig{Type: "feed", URL: server.URL}, nil)
+			for i := 0; i < 20; i++ {
+				s, err := source.Next(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.URL == "" {
+					t.Fatalf("picked an item without a link: %+v", s)
+				}
+			}
+		})
+	}
+}
+
+func TestFeedSourceErrors(t *testing.T) {
+	noLinks := serveFixture(t, "application/rss+xml", `<rss><channel><item><title>No link</title></item></channel></rss>`)
+	if _, err := randomFeedItem(context.Background(), noLinks.URL); err == nil || !isPermanent(err) {
+		t.Errorf("feed without links: err = %v, want a permanent error", err)
+	}
+
+	invalid := serveFixture(t, "text/html", `<html><body>Not a feed`)
+	if _, err := fetchFeed(context.Background(), invalid.URL); err == nil {
+		t.Error("invalid feed parsed")
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	if _, err := fetchFeed(context.Background(), missing.URL); err == nil || !isPermanent(err) {
+		t.Errorf("404: err = %v, want a permanent error", err)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	prompts := write("prompts.txt", "# Reading list\n\n  Read about Kubernetes operators  \n# https://commented.example.com/\nhttps://go.dev/doc/effective_go\n")
+	source := newTestSource(t, SourceConfig{Type: "file", Path: prompts}, nil)
+	seen := map[Suggestion]bool{}
+	for i := 0; i < 50; i++ {
+		s, err := source.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[s] = true
+	}
+	want := map[Suggestion]bool{
+		{Title: "Read about Kubernetes operators"}: true,
+		{URL: "https://go.dev/doc/effective_go"}:   true,
+	}
+	if len(seen) != len(want) {
+		t.Errorf("suggestions = %v, want %v", seen, want)
+	}
+	for s := range seen {
+		if !want[s] {
+			t.Errorf("unexpected suggestion %+v", s)
+		}
+	}
+
+	for name, path := range map[string]string{
+		"only comments": write("empty.txt", "# nothing\n\n"),
+		"missing file":  filepath.Join(dir, "missing.txt"),
+	} {
+		source := newTestSource(t, SourceConfig{Type: "file", Path: path}, nil)
+		if _, err := source.Next(context.Background()); err == nil || !isPermanent(err) {
+			t.Errorf("%s: err = %v, want a permanent error", name, err)
+		}
+	}
+}
+
+func TestLoadSources(t *testing.T) {
+	wiki, _ := NewWiki("en", "", "")
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "sources.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	sources, err := loadSources("", wiki)
+	if err != nil || len(sources.sources) != 1 || sources.Pick().Name() != "wikipedia-random" {
+		t.Fatalf("default sources = %+v, %v", sources, err)
+	}
+
+	sources, err = loadSources(write(`{"sources": [
+		{"type": "wikipedia-featured", "weight": 3},
+		{"type": "file", "path": "/prompts.txt"}
+	]}`), wiki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sources.total != 4 {
+		t.Errorf("total weight = %d, want 4 with the default weight of 1", sources.total)
+	}
+	picks := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		picks[sources.Pick().Name()]++
+	}
+	if featured := picks["wikipedia-featured"]; featured < 2700 || featured > 3300 {
+		t.Errorf("picks = %v, want about 3 featured for each file", picks)
+	}
+
+	for config, want := range map[string]string{
+		`{"sources": []}`:                                           "no sources",
+		`{"sources": [{"type": "podcast"}]}`:                        "unknown type",
+		`{"sources": [{"type": "feed"}]}`:                           "url is required",
+		`{"sources": [{"type": "wikipedia-category"}]}`:             "category is required",
+		`{"sources": [{"type": "file"}]}`:                           "path is required",
+		`{"sources": [{"type": "wikipedia-random", "weight": -1}]}`: "weight must not be negative",
+		`{"sources": [{"type": "wikipedia-random", "wieght": 2}]}`:  "unknown field",
+	} {
+		if _, err := loadSources(write(config), wiki); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", config, err, want)
+		}
+	}
+}
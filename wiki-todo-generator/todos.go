@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// backendToken is the API token sent to the backend, from TODO_API_TOKEN.
+var backendToken string
+
+// Todo is a todo as returned by GET /todos on the backend.
+type Todo struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+	URL  string `json:"url"`
+	Done bool   `json:"done"`
+}
+
+// getTodos fetches all existing todos from the backend.
+func getTodos(ctx context.Context, backendURL string) ([]Todo, error) {
+	resp, err := doRequest(ctx, func() (*http.Request, error) {
+		return newBackendRequest("GET", backendURL, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request todos: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(resp)
+	}
+
+	var todos []Todo
+	if err := json.NewDecoder(resp.Body).Decode(&todos); err != nil {
+		return nil, fmt.Errorf("failed to parse todos: %w", err)
+	}
+	return todos, nil
+}
+
+// newBackendRequest returns a request to the backend with the API token.
+// Requests to other hosts must not get it.
+func newBackendRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if backendToken != "" {
+		req.Header.Set("Authorization", "Bearer "+backendToken)
+	}
+	return req, nil
+}
+
+// existingTodos returns the keys of all existing todos, done or not.
+func existingTodos(todos []Todo) map[string]bool {
+	keys := make(map[string]bool)
+	for _, todo := range todos {
+		keys[todoKey(todo)] = true
+	}
+	return keys
+}
+
+// undoneReadTodos counts the undone reading todos, which are the ones this
+// generator creates from articles and feeds: todos with a url, and older
+// "Read <url>" todos.
+func undoneReadTodos(todos []Todo) int {
+	undone := 0
+	for _, todo := range todos {
+		if !todo.Done && strings.HasPrefix(todoKey(todo), "url:") {
+			undone++
+		}
+	}
+	return undone
+}
+
+// todoKey identifies a todo by its link if it has one, otherwise by its text.
+// Links in older "Read <url>" todos count too, and links are unescaped so
+// that todos created before article URLs were escaped still match.
+func todoKey(todo Todo) string {
+	if todo.URL != "" {
+		return "url:" + normalizeArticleURL(todo.URL)
+	}
+	text := strings.TrimSpace(todo.Text)
+	if u, ok := strings.CutPrefix(text, "Read "); ok && strings.HasPrefix(u, "http") {
+		return "url:" + normalizeArticleURL(u)
+	}
+	return "text:" + text
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const userAgent = "WikiTodoGenerator/1.0 (Kubernetes CronJob)"
+
+var wikiLangPattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z]+)*$`)
+
+// Wiki is the API of one language edition of Wikipedia: the MediaWiki
+// Action API for queries and the REST API for the featured feed.
+type Wiki struct {
+	Lang    string
+	APIURL  string
+	RESTURL string
+}
+
+// NewWiki returns the Wikipedia API for lang, e.g. "en", "fi" or "sv".
+// apiURL and restURL override the endpoints, which is useful against a
+// local stub.
+func NewWiki(lang, apiURL, restURL string) (*Wiki, error) {
+	if !wikiLangPattern.MatchString(lang) {
+		return nil, fmt.Errorf("invalid WIKI_LANG %q: expected a language code such as en, fi or sv", lang)
+	}
+	if apiURL == "" {
+		apiURL = fmt.Sprintf("https://%s.wikipedia.org/w/api.php", lang)
+	}
+	if restURL == "" {
+		restURL = fmt.Sprintf("https://%s.wikipedia.org/api/rest_v1", lang)
+	}
+	return &Wiki{Lang: lang, APIURL: apiURL, RESTURL: strings.TrimSuffix(restURL, "/")}, nil
+}
+
+// BaseURL is where this wiki's articles live, e.g. https://fi.wikipedia.org/wiki/.
+func (wk *Wiki) BaseURL() string {
+	return fmt.Sprintf("https://%s.wikipedia.org/wiki/", wk.Lang)
+}
+
+type wikiPage struct {
+	PageID  int    `json:"pageid"`
+	Title   string `json:"title"`
+	FullURL string `json:"fullurl"`
+}
+
+type WikiAPIResponse struct {
+	Query struct {
+		Pages map[string]wikiPage `json:"pages"`
+	} `json:"query"`
+}
+
+// RandomArticles returns n random articles in one request. The URLs come
+// from the API's fullurl, so titles with ?, #, % or non-ASCII characters are
+// escaped the way MediaWiki expects.
+func (wk *Wiki) RandomArticles(ctx context.Context, n int) ([]Suggestion, error) {
+	pages, err := wk.queryPages(ctx, url.Values{
+		"generator":    {"random"},
+		"grnnamespace": {"0"},
+		"grnlimit":     {strconv.Itoa(n)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, permanent(fmt.Errorf("no random article found"))
+	}
+
+	articles := make([]Suggestion, 0, len(pages))
+	for _, page := range pages {
+		articles = append(articles, wk.suggestion(page))
+	}
+	return articles, nil
+}
+
+// CategoryArticle returns a random article from the category, e.g. "Physics"
+// or "Category:Physics". Only the first 500 members are considered.
+func (wk *Wiki) CategoryArticle(ctx context.Context, category string) (Suggestion, error) {
+	if !strings.HasPrefix(category, "Category:") {
+		category = "Category:" + category
+	}
+
+	pages, err := wk.queryPages(ctx, url.Values{
+		"generator":    {"categorymembers"},
+		"gcmtitle":     {category},
+		"gcmnamespace": {"0"},
+		"gcmtype":      {"page"},
+		"gcmlimit":     {"500"},
+	})
+	if err != nil {
+		return Suggestion{}, err
+	}
+	if len(pages) == 0 {
+		return Suggestion{}, permanent(fmt.Errorf("no articles found in %s", category))
+	}
+	return wk.suggestion(pages[rand.Intn(len(pages))]), nil
+}
+
+// queryPages runs a generator query with prop=info&inprop=url, so every page
+// comes with its canonical URL. Pages are ordered by ID.
+func (wk *Wiki) queryPages(ctx context.Context, params url.Values) ([]wikiPage, error) {
+	params.Set("action", "query")
+	params.Set("format", "json")
+	params.Set("prop", "info")
+	params.Set("inprop", "url")
+
+	var apiResp WikiAPIResponse
+	if err := getJSON(ctx, wk.APIURL+"?"+params.Encode(), &apiResp); err != nil {
+		return nil, err
+	}
+
+	pages := make([]wikiPage, 0, len(apiResp.Query.Pages))
+	for _, page := range apiResp.Query.Pages {
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].PageID < pages[j].PageID })
+	return pages, nil
+}
+
+func (wk *Wiki) suggestion(page wikiPage) Suggestion {
+	u := page.FullURL
+	if u == "" {
+		u = wk.ArticleURL(page.Title)
+	}
+	return Suggestion{ID: wk.pageID(page.PageID), Title: page.Title, URL: u}
+}
+
+// pageID identifies a page across language editions, e.g. fi.wikipedia.org/12345.
+func (wk *Wiki) pageID(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s.wikipedia.org/%d", wk.Lang, id)
+}
+
+// pageSummary is the REST API's short description of a page, used by both
+// the summary endpoint and the featured feed.
+type pageSummary struct {
+	PageID int `json:"pageid"`
+	Titles struct {
+		Normalized string `json:"normalized"`
+	} `json:"titles"`
+	Extract     string `json:"extract"`
+	ContentURLs struct {
+		Desktop struct {
+			Page string `json:"page"`
+		} `json:"desktop"`
+	} `json:"content_urls"`
+}
+
+func (wk *Wiki) summarySuggestion(summary pageSummary) Suggestion {
+	s := Suggestion{
+		ID:      wk.pageID(summary.PageID),
+		Title:   summary.Titles.Normalized,
+		URL:     summary.ContentURLs.Desktop.Page,
+		Summary: strings.TrimSpace(summary.Extract),
+	}
+	if s.URL == "" {
+		s.URL = wk.ArticleURL(s.Title)
+	}
+	return s
+}
+
+// Summary returns the title, short extract and URL of the article title from
+// the REST summary endpoint.
+func (wk *Wiki) Summary(ctx context.Context, title string) (Suggestion, error) {
+	// PathEscape also escapes slashes, which the REST API expects in titles
+	var summary pageSummary
+	path := "/page/summary/" + url.PathEscape(strings.ReplaceAll(title, " ", "_"))
+	if err := getJSON(ctx, wk.RESTURL+path, &summary); err != nil {
+		return Suggestion{}, err
+	}
+	return wk.summarySuggestion(summary), nil
+}
+
+// WithSummary fills in the summary of article. Without one the todo is still
+// useful, so failures are only logged.
+func (wk *Wiki) WithSummary(ctx context.Context, article Suggestion) Suggestion {
+	summary, err := wk.Summary(ctx, article.Title)
+	if err != nil {
+		fmt.Printf("No summary for %q: %v\n", article.Title, err)
+		return article
+	}
+	if summary.Title == "" {
+		summary.Title = article.Title
+	}
+	// Keep the canonical URL and ID from the Action API
+	summary.URL = article.URL
+	summary.ID = article.ID
+	return summary
+}
+
+// FeaturedArticle returns the featured article of the day for date, with its
+// summary. Not every language edition has one.
+func (wk *Wiki) FeaturedArticle(ctx context.Context, date time.Time) (Suggestion, error) {
+	var feed struct {
+		TFA *pageSummary `json:"tfa"`
+	}
+
+	if err := getJSON(ctx, wk.RESTURL+"/feed/featured/"+date.Format("2006/01/02"), &feed); err != nil {
+		return Suggestion{}, err
+	}
+	if feed.TFA == nil {
+		return Suggestion{}, permanent(fmt.Errorf("no featured article for %s on %s.wikipedia.org", date.Format("2006-01-02"), wk.Lang))
+	}
+	return wk.summarySuggestion(*feed.TFA), nil
+}
+
+// ArticleURL builds the URL of title: spaces become underscores and the
+// rest is path-escaped. Slashes are kept, as in /wiki/AC/DC.
+func (wk *Wiki) ArticleURL(title string) string {
+	path := (&url.URL{Path: strings.ReplaceAll(title, " ", "_")}).EscapedPath()
+	return wk.BaseURL() + path
+}
+
+// normalizeArticleURL maps differently escaped forms of the same article
+// URL to one key, so todos created before escaping was fixed still match.
+func normalizeArticleURL(u string) string {
+	if unescaped, err := url.PathUnescape(u); err == nil {
+		u = unescaped
+	}
+	return strings.ReplaceAll(u, " ", "_")
+}
+
+// getJSON fetches rawURL with the Wikipedia User-Agent and decodes the JSON
+// response into v.
+func getJSON(ctx context.Context, rawURL string, v any) error {
+	resp, err := doRequest(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		// Set User-Agent as required by Wikipedia
+		req.Header.Set("User-Agent", userAgent)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return unexpectedStatus(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse JSON from %s: %w", rawURL, err)
+	}
+	return nil
+}
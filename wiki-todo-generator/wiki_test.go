@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubArticle is a page on the stub wiki. FullURL is escaped the way
+// MediaWiki escapes it.
+type stubArticle struct {
+	ID      int
+	Title   string
+	FullURL string
+	Extract string
+}
+
+var stubArticles = []stubArticle{
+	{1, "What?", "https://fi.wikipedia.org/wiki/What%3F", "A question."},
+	{2, "C# (programming language)", "https://fi.wikipedia.org/wiki/C_Sharp_(programming_language)", "Redirected by MediaWiki."},
+	{3, "100% Orange Juice", "https://fi.wikipedia.org/wiki/100%25_Orange_Juice", "A game."},
+	{4, "AT&T", "https://fi.wikipedia.org/wiki/AT%26T", "A company."},
+	{5, "Käärijä", "https://fi.wikipedia.org/wiki/K%C3%A4%C3%A4rij%C3%A4", "A singer."},
+	{6, "AC/DC", "", "A band, without a fullurl in the response."},
+}
+
+// stubWiki serves the parts of the MediaWiki Action API and the REST API
+// that Wiki uses, from stubArticles.
+type stubWiki struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	queries  []url.Values
+	featured map[string]stubArticle
+}
+
+func newStubWiki(t *testing.T) *stubWiki {
+	s := &stubWiki{t: t, featured: make(map[string]stubArticle)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubWiki) wiki(t *testing.T, lang string) *Wiki {
+	t.Helper()
+	wk, err := NewWiki(lang, s.URL+"/w/api.php", s.URL+"/api/rest_v1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wk
+}
+
+func (s *stubWiki) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("User-Agent") != userAgent {
+		s.t.Errorf("%s sent User-Agent %q", r.URL, r.Header.Get("User-Agent"))
+	}
+
+	// Titles are read from the escaped path, as Wikipedia does; an
+	// unescaped ? or # would not reach the server as part of the title
+	path := r.URL.EscapedPath()
+	switch {
+	case path == "/w/api.php":
+		s.serveQuery(w, r.URL.Query())
+
+	case strings.HasPrefix(path, "/api/rest_v1/page/summary/"):
+		title, err := url.PathUnescape(strings.TrimPrefix(path, "/api/rest_v1/page/summary/"))
+		if err != nil {
+			http.Error(w, "bad title", http.StatusBadRequest)
+			return
+		}
+		for _, a := range stubArticles {
+			if strings.ReplaceAll(a.Title, " ", "_") == title {
+				json.NewEncoder(w).Encode(stubSummary(a))
+				return
+			}
+		}
+		http.NotFound(w, r)
+
+	case strings.HasPrefix(path, "/api/rest_v1/feed/featured/"):
+		s.mu.Lock()
+		a, ok := s.featured[strings.TrimPrefix(path, "/api/rest_v1/feed/featured/")]
+		s.mu.Unlock()
+		feed := map[string]any{}
+		if ok {
+			feed["tfa"] = stubSummary(a)
+		}
+		json.NewEncoder(w).Encode(feed)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *stubWiki) serveQuery(w http.ResponseWriter, params url.Values) {
+	s.mu.Lock()
+	s.queries = append(s.queries, params)
+	s.mu.Unlock()
+
+	pages := map[string]any{}
+	add := func(a stubArticle) {
+		page := map[string]any{"pageid": a.ID, "ns": 0, "title": a.Title}
+		if a.FullURL != "" {
+			page["fullurl"] = a.FullURL
+		}
+		pages[strconv.Itoa(a.ID)] = page
+	}
+	switch params.Get("generator") {
+	case "random":
+		for _, a := range stubArticles {
+			add(a)
+		}
+	case "categorymembers":
+		if params.Get("gcmtitle") == "Category:Music" {
+			add(stubArticles[4])
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"batchcomplete": "", "query": map[string]any{"pages": pages}})
+}
+
+func stubSummary(a stubArticle) map[string]any {
+	summary := map[string]any{
+		"pageid":  a.ID,
+		"titles":  map[string]string{"normalized": a.Title},
+		"extract": a.Extract + "\n",
+	}
+	if a.FullURL != "" {
+		summary["content_urls"] = map[string]any{"desktop": map[string]string{"page": a.FullURL}}
+	}
+	return summary
+}
+
+func (s *stubWiki) lastQuery() url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[len(s.queries)-1]
+}
+
+func TestNewWiki(t *testing.T) {
+	for _, lang := range []string{"en", "fi", "sv", "zh-yue", "be-tarask"} {
+		if _, err := NewWiki(lang, "", ""); err != nil {
+			t.Errorf("NewWiki(%q): %v", lang, err)
+		}
+	}
+	for _, lang := range []string{"", "e", "EN", "english", "en.evil.example", "en/../x", "fi?"} {
+		if _, err := NewWiki(lang, "", ""); err == nil {
+			t.Errorf("NewWiki(%q) accepted", lang)
+		}
+	}
+
+	wk, _ := NewWiki("fi", "", "")
+	if wk.APIURL != "https://fi.wikipedia.org/w/api.php" || wk.RESTURL != "https://fi.wikipedia.org/api/rest_v1" {
+		t.Errorf("fi endpoints = %s and %s", wk.APIURL, wk.RESTURL)
+	}
+	if wk.BaseURL() != "https://fi.wikipedia.org/wiki/" {
+		t.Errorf("fi base URL = %s", wk.BaseURL())
+	}
+}
+
+func TestWikiLangConfig(t *testing.T) {
+	t.Setenv("SOURCES_CONFIG", "")
+	t.Setenv("WIKI_API_URL", "")
+	t.Setenv("WIKI_REST_URL", "")
+
+	t.Setenv("WIKI_LANG", "sv")
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wk := config.Sources.sources[0].source.(wikiRandomSource).wiki
+	if wk.Lang != "sv" || wk.APIURL != "https://sv.wikipedia.org/w/api.php" {
+		t.Errorf("WIKI_LANG=sv gave %s at %s", wk.Lang, wk.APIURL)
+	}
+
+	t.Setenv("WIKI_LANG", "sv.example.com")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "WIKI_LANG") {
+		t.Errorf("invalid WIKI_LANG: err = %v", err)
+	}
+}
+
+func TestArticleURL(t *testing.T) {
+	wk, _ := NewWiki("fi", "", "")
+	for title, want := range map[string]string{
+		"Helsinki":            "https://fi.wikipedia.org/wiki/Helsinki",
+		"What?":               "https://fi.wikipedia.org/wiki/What%3F",
+		"C# (language)":       "https://fi.wikipedia.org/wiki/C%23_%28language%29",
+		"100% Orange Juice":   "https://fi.wikipedia.org/wiki/100%25_Orange_Juice",
+		"AT&T":                "https://fi.wikipedia.org/wiki/AT&T",
+		"Käärijä":             "https://fi.wikipedia.org/wiki/K%C3%A4%C3%A4rij%C3%A4",
+		"AC/DC":               "https://fi.wikipedia.org/wiki/AC/DC",
+		"Tōkyō Disneyland #2": "https://fi.wikipedia.org/wiki/T%C5%8Dky%C5%8D_Disneyland_%232",
+	} {
+		if got := wk.ArticleURL(title); got != want {
+			t.Errorf("ArticleURL(%q) = %s, want %s", title, got, want)
+		}
+		// Parsing the URL gives the title back
+		u, err := url.Parse(wk.ArticleURL(title))
+		if err != nil || u.RawQuery != "" || u.Fragment != "" || strings.TrimPrefix(u.Path, "/wiki/") != strings.ReplaceAll(title, " ", "_") {
+			t.Errorf("ArticleURL(%q) does not parse back to the title: %v %+v", title, err, u)
+		}
+	}
+}
+
+func TestRandomArticlesUseFullURL(t *testing.T) {
+	stub := newStubWiki(t)
+	wk := stub.wiki(t, "fi")
+
+	articles, err := wk.RandomArticles(context.Background(), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := stub.lastQuery()
+	for param, want := range map[string]string{
+		"action": "query", "generator": "random", "grnnamespace": "0", "grnlimit": "6", "prop": "info", "inprop": "url",
+	} {
+		if got := query.Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
+
+	if len(articles) != len(stubArticles) {
+		t.Fatalf("got %d articles, want %d", len(articles), len(stubArticles))
+	}
+	for i, a := range stubArticles {
+		want := a.FullURL
+		if want == "" {
+			// Built from the title when the API has no fullurl
+			want = "https://fi.wikipedia.org/wiki/AC/DC"
+		}
+		got := articles[i]
+		if got.Title != a.Title || got.URL != want {
+			t.Errorf("article %d = %q %s, want %q %s", i, got.Title, got.URL, a.Title, want)
+		}
+		if wantID := "fi.wikipedia.org/" + strconv.Itoa(a.ID); got.ID != wantID {
+			t.Errorf("article %d ID = %q, want %q", i, got.ID, wantID)
+		}
+	}
+}
+
+func TestSummaryEscapesTitles(t *testing.T) {
+	stub := newStubWiki(t)
+	wk := stub.wiki(t, "fi")
+
+	for _, a := range stubArticles {
+		summary, err := wk.Summary(context.Background(), a.Title)
+		if err != nil {
+			t.Errorf("Summary(%q): %v", a.Title, err)
+			continue
+		}
+		if summary.Title != a.Title || summary.Summary != a.Extract {
+			t.Errorf("Summary(%q) = %q %q", a.Title, summary.Title, summary.Summary)
+		}
+	}
+
+	if _, err := wk.Summary(context.Background(), "No such article"); err == nil || !isPermanent(err) {
+		t.Errorf("missing article: err = %v, want a permanent error", err)
+	}
+}
+
+func TestWithSummaryKeepsCanonicalURL(t *testing.T) {
+	stub := newStubWiki(t)
+	wk := stub.wiki(t, "fi")
+
+	article := Suggestion{ID: "fi.wikipedia.org/3", Title: "100% Orange Juice", URL: "https://fi.wikipedia.org/wiki/100%25_Orange_Juice"}
+	got := wk.WithSummary(context.Background(), article)
+	if got.URL != article.URL || got.ID != article.ID || got.Summary != "A game." {
+		t.Errorf("WithSummary = %+v", got)
+	}
+
+	// Without a summary the article is used as it is
+	missing := Suggestion{Title: "No such article", URL: "https://fi.wikipedia.org/wiki/No_such_article"}
+	if got := wk.WithSummary(context.Background(), missing); got != missing {
+		t.Errorf("WithSummary without a summary = %+v", got)
+	}
+}
+
+func TestCategoryArticle(t *testing.T) {
+	stub := newStubWiki(t)
+	wk := stub.wiki(t, "fi")
+
+	for _, category := range []string{"Music", "Category:Music"} {
+		article, err := wk.CategoryArticle(context.Background(), category)
+		if err != nil {
+			t.Fatalf("CategoryArticle(%q): %v", category, err)
+		}
+		if got := stub.lastQuery().Get("gcmtitle"); got != "Category:Music" {
+			t.Errorf("CategoryArticle(%q) asked for %q", category, got)
+		}
+		if article.Title != "Käärijä" || article.URL != stubArticles[4].FullURL {
+			t.Errorf("CategoryArticle(%q) = %+v", category, article)
+		}
+	}
+
+	if _, err := wk.CategoryArticle(context.Background(), "Empty"); err == nil || !isPermanent(err) {
+		t.Errorf("empty category: err = %v, want a permanent error", err)
+	}
+}
+
+func TestFeaturedArticle(t *testing.T) {
+	stub := newStubWiki(t)
+	stub.featured["2025/12/01"] = stubArticles[0]
+	wk := stub.wiki(t, "fi")
+
+	article, err := wk.FeaturedArticle(context.Background(), time.Date(2025, 12, 1, 23, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "What?" || article.URL != "https://fi.wikipedia.org/wiki/What%3F" || article.ID != "fi.wikipedia.org/1" {
+		t.Errorf("featured article = %+v", article)
+	}
+
+	if _, err := wk.FeaturedArticle(context.Background(), time.Date(2025, 12, 2, 0, 0, 0, 0, time.UTC)); err == nil || !isPermanent(err) {
+		t.Errorf("no featured article: err = %v, want a permanent error", err)
+	}
+}
+
+func TestNormalizeArticleURL(t *testing.T) {
+	// Todos created before titles were escaped still match
+	for _, pair := range [][2]string{
+		{"https://fi.wikipedia.org/wiki/K%C3%A4%C3%A4rij%C3%A4", "https://fi.wikipedia.org/wiki/Käärijä"},
+		{"https://fi.wikipedia.org/wiki/What%3F", "https://fi.wikipedia.org/wiki/What?"},
+		{"https://fi.wikipedia.org/wiki/100%25_Orange_Juice", "https://fi.wikipedia.org/wiki/100% Orange Juice"},
+	} {
+		if normalizeArticleURL(pair[0]) != normalizeArticleURL(pair[1]) {
+			t.Errorf("%s and %s normalize differently", pair[0], pair[1])
+		}
+	}
+}